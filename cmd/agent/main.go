@@ -0,0 +1,132 @@
+// Command agent runs on a woken computer. It sends heartbeats to the bot
+// server so the bot knows the computer is up, and carries out the shutdown,
+// reboot and sleep requests the server hands back.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/eblancof/telegram-bot/internal/agent"
+)
+
+const version = "1"
+
+func main() {
+	server := flag.String("server", "", "bot server URL, e.g. https://bot.lan:8443")
+	name := flag.String("name", "", "device name in the bot (default: hostname)")
+	interval := flag.Duration("interval", 15*time.Second, "time between heartbeats")
+	caFile := flag.String("ca", "", "PEM certificate to trust for a self-signed server")
+	dryRun := flag.Bool("dry-run", false, "log power commands instead of running them")
+	flag.Parse()
+
+	secret := os.Getenv("AGENT_SECRET")
+	if *server == "" || secret == "" {
+		log.Fatal("Both -server and the AGENT_SECRET environment variable are required")
+	}
+	hostname, _ := os.Hostname()
+	if *name == "" {
+		*name = hostname
+	}
+
+	c, err := agent.NewClient(*server, secret, *caFile)
+	if err != nil {
+		log.Fatalf("Failed to load CA certificate: %v", err)
+	}
+
+	actions := make([]string, 0, len(powerCommands))
+	for action := range powerCommands {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	hb := agent.Heartbeat{
+		Name:     *name,
+		Hostname: hostname,
+		OS:       runtime.GOOS,
+		Version:  version,
+		Interval: *interval,
+		Actions:  actions,
+	}
+
+	log.Printf("Reporting as %s to %s every %s", *name, c.Server, *interval)
+	for {
+		var resp agent.HeartbeatResponse
+		if err := c.Post(agent.HeartbeatPath, hb, &resp); err != nil {
+			log.Printf("Heartbeat failed: %v", err)
+		}
+		for _, cmd := range resp.Commands {
+			run(c, *name, cmd, *dryRun)
+		}
+		time.Sleep(*interval)
+	}
+}
+
+// exitWait is how long run waits for a power command to finish before
+// reporting it as started.
+const exitWait = 5 * time.Second
+
+// run carries out cmd. The result is reported once the command has exited or
+// after exitWait, since a shutdown may take the agent down before the
+// command returns.
+func run(c *agent.Client, name string, cmd agent.Command, dryRun bool) {
+	result := agent.Result{Name: name, ID: cmd.ID}
+	args, ok := powerCommands[cmd.Action]
+	switch {
+	case !ok:
+		result.Output = "unsupported action " + cmd.Action
+	case dryRun:
+		result.OK, result.Output = true, "dry run: "+strings.Join(args, " ")
+	default:
+		result.OK, result.Output = execute(cmd.Action, args)
+	}
+	log.Printf("%s: %s", cmd.Action, result.Output)
+
+	if err := c.Post(agent.ResultPath, result, nil); err != nil {
+		log.Printf("Failed to report result: %v", err)
+	}
+}
+
+// execute starts args and waits up to exitWait for it to exit. A command
+// still running by then is reported as started, and its exit status is
+// logged once it is reaped.
+func execute(action string, args []string) (ok bool, output string) {
+	var out bytes.Buffer
+	proc := exec.Command(args[0], args[1:]...)
+	proc.Stdout, proc.Stderr = &out, &out
+	if err := proc.Start(); err != nil {
+		return false, err.Error()
+	}
+	done := make(chan error, 1)
+	go func() { done <- proc.Wait() }()
+
+	select {
+	case err := <-done:
+		return err == nil, exitOutput(args, err, out.String())
+	case <-time.After(exitWait):
+		go func() {
+			if err := <-done; err != nil {
+				log.Printf("%s: %s", action, exitOutput(args, err, out.String()))
+			}
+		}()
+		return true, "started " + strings.Join(args, " ")
+	}
+}
+
+// exitOutput describes how args exited with err, followed by what it printed.
+func exitOutput(args []string, err error, printed string) string {
+	text := "ran " + strings.Join(args, " ")
+	if err != nil {
+		text = strings.Join(args, " ") + " failed: " + err.Error()
+	}
+	if printed = strings.TrimSpace(printed); printed != "" {
+		text += "\n" + printed
+	}
+	return text
+}
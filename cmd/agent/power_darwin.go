@@ -0,0 +1,11 @@
+//go:build darwin
+
+package main
+
+// powerCommands maps power actions to the commands carrying them out. The
+// agent is expected to run as root.
+var powerCommands = map[string][]string{
+	"shutdown": {"shutdown", "-h", "now"},
+	"reboot":   {"shutdown", "-r", "now"},
+	"sleep":    {"pmset", "sleepnow"},
+}
@@ -0,0 +1,11 @@
+//go:build linux
+
+package main
+
+// powerCommands maps power actions to the commands carrying them out. The
+// agent is expected to run as root.
+var powerCommands = map[string][]string{
+	"shutdown": {"systemctl", "poweroff"},
+	"reboot":   {"systemctl", "reboot"},
+	"sleep":    {"systemctl", "suspend"},
+}
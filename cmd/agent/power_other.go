@@ -0,0 +1,10 @@
+//go:build !linux && !windows && !darwin
+
+package main
+
+// powerCommands maps power actions to the commands carrying them out. The
+// agent is expected to run as root.
+var powerCommands = map[string][]string{
+	"shutdown": {"shutdown", "-p", "now"},
+	"reboot":   {"shutdown", "-r", "now"},
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package main
+
+// powerCommands maps power actions to the commands carrying them out. The
+// agent is expected to run as an administrator.
+var powerCommands = map[string][]string{
+	"shutdown": {"shutdown", "/s", "/t", "0"},
+	"reboot":   {"shutdown", "/r", "/t", "0"},
+	"sleep":    {"rundll32.exe", "powrprof.dll,SetSuspendState", "0,1,0"},
+}
@@ -0,0 +1,51 @@
+// Command enroll registers the machine it runs on with the bot, using a
+// one-time token from /enroll. It reports the hostname and the MAC and IP
+// address of the interface that reaches the bot server.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+
+	"github.com/eblancof/telegram-bot/internal/agent"
+)
+
+func main() {
+	server := flag.String("server", "", "bot server URL, e.g. https://bot.lan:8443")
+	token := flag.String("token", "", "one-time token from /enroll")
+	name := flag.String("name", "", "device name to propose (default: hostname)")
+	caFile := flag.String("ca", "", "PEM certificate to trust for a self-signed server")
+	flag.Parse()
+
+	if *server == "" || *token == "" {
+		log.Fatal("Both -server and -token are required")
+	}
+	if *name == "" {
+		*name, _ = os.Hostname()
+	}
+
+	iface, ip, err := agent.PrimaryInterface(*server)
+	if err != nil {
+		log.Fatalf("Failed to find the primary interface: %v", err)
+	}
+	enrollment := agent.Enrollment{
+		Hostname:  *name,
+		OS:        runtime.GOOS,
+		Interface: iface.Name,
+		MAC:       iface.HardwareAddr.String(),
+		IP:        ip.String(),
+	}
+
+	c, err := agent.NewClient(*server, *token, *caFile)
+	if err != nil {
+		log.Fatalf("Failed to load CA certificate: %v", err)
+	}
+	if err := c.Post(agent.EnrollPath, enrollment, nil); err != nil {
+		log.Fatalf("Enrollment failed: %v", err)
+	}
+	fmt.Printf("Enrollment of %s (%s on %s, %s) sent. Approve it in Telegram.\n",
+		enrollment.Hostname, enrollment.MAC, enrollment.Interface, enrollment.IP)
+}
@@ -0,0 +1,86 @@
+// Command relay sits on a LAN the bot server cannot broadcast to. It keeps
+// an authenticated HTTPS long poll open to the bot server and sends the
+// magic packets it is asked for on its own network.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/eblancof/telegram-bot/internal/agent"
+	"github.com/eblancof/telegram-bot/internal/device"
+	"github.com/eblancof/telegram-bot/internal/wol"
+)
+
+// retryDelay is the pause after a failed poll.
+const retryDelay = 5 * time.Second
+
+func main() {
+	server := flag.String("server", "", "bot server URL, e.g. https://bot.example.com:8443")
+	name := flag.String("name", "", "relay name devices refer to (default: hostname)")
+	caFile := flag.String("ca", "", "PEM certificate to trust for a self-signed server")
+	insecure := flag.Bool("insecure", false, "allow a plain http:// server URL")
+	flag.Parse()
+
+	secret := os.Getenv("AGENT_SECRET")
+	if *server == "" || secret == "" {
+		log.Fatal("Both -server and the AGENT_SECRET environment variable are required")
+	}
+	if u, err := url.Parse(*server); err != nil || (u.Scheme != "https" && !*insecure) {
+		log.Fatal("-server must be an https:// URL (use -insecure to allow http://)")
+	}
+	if *name == "" {
+		*name, _ = os.Hostname()
+	}
+
+	c, err := agent.NewClient(*server, secret, *caFile)
+	if err != nil {
+		log.Fatalf("Failed to load CA certificate: %v", err)
+	}
+	c.HTTP.Timeout = agent.RelayPollTimeout + 10*time.Second
+
+	log.Printf("Relaying wakes for %s as %s", c.Server, *name)
+	for {
+		var resp agent.RelayPollResponse
+		if err := c.Post(agent.RelayPollPath, agent.RelayPoll{Name: *name}, &resp); err != nil {
+			log.Printf("Poll failed: %v", err)
+			time.Sleep(retryDelay)
+			continue
+		}
+		for _, req := range resp.Requests {
+			go relay(c, *name, req)
+		}
+	}
+}
+
+// relay sends the magic packets for req and reports the outcome.
+func relay(c *agent.Client, name string, req agent.WakeRequest) {
+	result := agent.WakeResult{Relay: name, ID: req.ID}
+	mac, err := device.ParseMAC(req.MAC)
+	if err == nil {
+		target := wol.Target{
+			Transport:     req.Transport,
+			Address:       req.Address,
+			Port:          req.Port,
+			Interface:     req.Interface,
+			AllInterfaces: req.AllInterfaces,
+			Count:         req.Count,
+			Interval:      time.Duration(req.IntervalMs) * time.Millisecond,
+		}
+		if (target.Transport == "" || target.Transport == wol.TransportUDP) && target.Address == "" && target.Interface == "" {
+			target.AllInterfaces = true
+		}
+		result.Sent, result.Attempted, err = wol.SendWakeOnLAN(mac, req.SecureOn, target)
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	log.Printf("Wake %s: %d/%d packet(s) sent %v", req.MAC, result.Sent, result.Attempted, err)
+
+	if err := c.Post(agent.RelayResultPath, result, nil); err != nil {
+		log.Printf("Failed to report result: %v", err)
+	}
+}
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"os"
 
 	"github.com/eblancof/telegram-bot/internal/bot"
 	"github.com/eblancof/telegram-bot/internal/config"
 	"github.com/eblancof/telegram-bot/internal/device"
+	"github.com/eblancof/telegram-bot/internal/dnswake"
+	"github.com/eblancof/telegram-bot/internal/hub"
+	"github.com/eblancof/telegram-bot/internal/monitor"
+	"github.com/eblancof/telegram-bot/internal/proxy"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -13,8 +20,29 @@ import (
 func main() {
 	cfg := config.Load()
 
-	if err := device.LoadDevices(); err != nil {
+	if err := device.LoadDevices(); errors.Is(err, os.ErrNotExist) {
 		log.Println("No existing devices found. Starting fresh.")
+	} else if err != nil {
+		log.Fatalf("Failed to load devices: %v", err)
+	}
+	if err := device.LoadBootTimes(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Failed to load boot times: %v", err)
+	}
+
+	if cfg.AgentListen != "" {
+		if cfg.AgentSecret == "" {
+			log.Fatal("AGENT_LISTEN is set but AGENT_SECRET is empty")
+		}
+		hub.Start(cfg.AgentListen)
+	}
+	monitor.Start(context.Background(), cfg.MonitorInterval)
+	if err := proxy.Start(cfg.WakeProxy, bot.Wake); err != nil {
+		log.Fatalf("Failed to start wake proxy: %v", err)
+	}
+	if cfg.DNSListen != "" {
+		if err := dnswake.Start(cfg.DNSListen, bot.Wake); err != nil {
+			log.Fatalf("Failed to start DNS responder: %v", err)
+		}
 	}
 
 	botAPI, err := tgbotapi.NewBotAPI(cfg.BotToken)
@@ -33,5 +61,8 @@ func main() {
 	msg.ReplyMarkup = bot.CreateDeviceKeyboard()
 	botAPI.Send(msg)
 
+	bot.StartNotifications(botAPI)
+	bot.StartKeyboardRefresh(botAPI)
+	bot.StartEnrollment(botAPI)
 	bot.HandleMessages(botAPI)
 }
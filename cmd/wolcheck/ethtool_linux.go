@@ -0,0 +1,51 @@
+//go:build linux
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const (
+	siocEthtool  = 0x8946
+	ethtoolGWoL  = 0x00000005
+	ifNameSize   = 16
+	sopassLength = 6
+)
+
+// ethtoolWoLInfo mirrors struct ethtool_wolinfo.
+type ethtoolWoLInfo struct {
+	cmd       uint32
+	supported uint32
+	wolopts   uint32
+	sopass    [sopassLength]byte
+}
+
+// ifreq mirrors struct ifreq with ifr_data set.
+type ifreq struct {
+	name [ifNameSize]byte
+	data unsafe.Pointer
+	_    [16]byte
+}
+
+// wolSettings returns the supported and enabled WAKE_* bits of iface using
+// the ETHTOOL_GWOL ioctl, which needs CAP_NET_ADMIN.
+func wolSettings(iface string) (supported, enabled uint32, err error) {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer syscall.Close(fd)
+
+	info := ethtoolWoLInfo{cmd: ethtoolGWoL}
+	var req ifreq
+	copy(req.name[:ifNameSize-1], iface)
+	req.data = unsafe.Pointer(&info)
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), siocEthtool, uintptr(unsafe.Pointer(&req)))
+	if errno != 0 {
+		return 0, 0, errno
+	}
+	return info.supported, info.wolopts, nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func wolSettings(iface string) (supported, enabled uint32, err error) {
+	return 0, 0, errors.New("reading Wake-on-LAN settings is only supported on linux")
+}
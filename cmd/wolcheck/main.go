@@ -0,0 +1,124 @@
+// Command wolcheck runs on a target machine, reads the Wake-on-LAN settings
+// of its network interface and reports to the bot server whether a magic
+// packet would wake it, so the bot can warn before powering it off.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/eblancof/telegram-bot/internal/agent"
+)
+
+// wakeModes names the ethtool WAKE_* bits, in bit order.
+var wakeModes = []string{"phy", "unicast", "multicast", "broadcast", "arp", "magic", "magicsecure", "filter"}
+
+const (
+	wakeMagic       = 1 << 5
+	wakeMagicSecure = 1 << 6
+)
+
+func main() {
+	server := flag.String("server", "", "bot server URL; without it the settings are only printed")
+	name := flag.String("name", "", "device name in the bot (default: hostname)")
+	ifaceName := flag.String("iface", "", "interface to check (default: the one reaching -server)")
+	interval := flag.Duration("interval", 0, "report again at this interval instead of once")
+	caFile := flag.String("ca", "", "PEM certificate to trust for a self-signed server")
+	flag.Parse()
+
+	if *name == "" {
+		*name, _ = os.Hostname()
+	}
+	iface, err := findInterface(*ifaceName, *server)
+	if err != nil {
+		log.Fatalf("Failed to find the interface: %v", err)
+	}
+
+	var c *agent.Client
+	if *server != "" {
+		secret := os.Getenv("AGENT_SECRET")
+		if secret == "" {
+			log.Fatal("The AGENT_SECRET environment variable is required with -server")
+		}
+		if c, err = agent.NewClient(*server, secret, *caFile); err != nil {
+			log.Fatalf("Failed to load CA certificate: %v", err)
+		}
+	}
+
+	for {
+		report := check(*name, iface)
+		fmt.Println(describe(report))
+		if c != nil {
+			if err := c.Post(agent.WoLPath, report, nil); err != nil {
+				log.Printf("Failed to report: %v", err)
+			}
+		}
+		if *interval <= 0 {
+			return
+		}
+		time.Sleep(*interval)
+	}
+}
+
+func findInterface(name, server string) (net.Interface, error) {
+	if name != "" {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			return net.Interface{}, err
+		}
+		return *iface, nil
+	}
+	if server == "" {
+		return net.Interface{}, fmt.Errorf("-iface is required without -server")
+	}
+	iface, _, err := agent.PrimaryInterface(server)
+	return iface, err
+}
+
+// check reads the Wake-on-LAN settings of iface.
+func check(name string, iface net.Interface) agent.WoLReport {
+	report := agent.WoLReport{Name: name, Interface: iface.Name, MAC: iface.HardwareAddr.String()}
+	supported, enabled, err := wolSettings(iface.Name)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	report.Supported = modeNames(supported)
+	report.Enabled = modeNames(enabled)
+	report.Armed = enabled&(wakeMagic|wakeMagicSecure) != 0
+	return report
+}
+
+func modeNames(mask uint32) []string {
+	var names []string
+	for bit, mode := range wakeModes {
+		if mask&(1<<bit) != 0 {
+			names = append(names, mode)
+		}
+	}
+	return names
+}
+
+func describe(r agent.WoLReport) string {
+	switch {
+	case r.Error != "":
+		return fmt.Sprintf("%s: failed to read Wake-on-LAN settings: %s", r.Interface, r.Error)
+	case r.Armed:
+		return fmt.Sprintf("%s (%s): magic packet wake armed (enabled: %s)", r.Interface, r.MAC, strings.Join(r.Enabled, ", "))
+	default:
+		return fmt.Sprintf("%s (%s): magic packet wake NOT armed (supported: %s, enabled: %s); try ethtool -s %s wol g",
+			r.Interface, r.MAC, list(r.Supported), list(r.Enabled), r.Interface)
+	}
+}
+
+func list(modes []string) string {
+	if len(modes) == 0 {
+		return "none"
+	}
+	return strings.Join(modes, ", ")
+}
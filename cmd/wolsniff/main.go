@@ -0,0 +1,146 @@
+// Command wolsniff listens for Wake-on-LAN magic packets and reports what
+// it receives, to check whether wakes sent by the bot reach the network.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eblancof/telegram-bot/internal/device"
+	"github.com/eblancof/telegram-bot/pkg/magicpacket"
+)
+
+// capture is a magic packet candidate received by one of the listeners.
+type capture struct {
+	via     string
+	source  string
+	payload []byte
+}
+
+func main() {
+	ports := flag.String("ports", "7,9", "comma separated UDP ports to listen on")
+	raw := flag.Bool("raw", false, "also capture raw EtherType 0x0842 frames (linux, needs CAP_NET_RAW)")
+	iface := flag.String("iface", "", "interface for raw capture (default: all interfaces)")
+	devicesFile := flag.String("devices", "devices.json", "devices file used to match captured MACs")
+	verbose := flag.Bool("v", false, "also report datagrams that are not magic packets")
+	flag.Parse()
+
+	devices, err := loadDevices(*devicesFile)
+	if err != nil {
+		log.Printf("Not matching against devices: %v", err)
+	}
+
+	captures := make(chan capture)
+	for _, p := range strings.Split(*ports, ",") {
+		port, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			log.Fatalf("Invalid port %q", p)
+		}
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: port})
+		if err != nil {
+			log.Fatalf("Failed to listen on UDP port %d: %v", port, err)
+		}
+		log.Printf("Listening on UDP port %d", port)
+		go listenUDP(conn, fmt.Sprintf("udp/%d", port), captures)
+	}
+
+	if *raw {
+		if err := listenRaw(*iface, captures); err != nil {
+			log.Fatalf("Failed to capture raw frames: %v", err)
+		}
+		log.Printf("Capturing EtherType 0x%04x frames", magicpacket.EtherType)
+	}
+
+	for c := range captures {
+		var packet magicpacket.MagicPacket
+		if err := packet.Unmarshal(c.payload); err != nil {
+			if *verbose {
+				log.Printf("%s from %s: ignored %d bytes (%v)", c.via, c.source, len(c.payload), err)
+			}
+			continue
+		}
+		log.Printf("%s from %s: magic packet for %s, %s, %s",
+			c.via, c.source, strings.ToUpper(packet.MAC.String()), describePassword(packet.Password), matchDevice(devices, packet.MAC))
+	}
+}
+
+func listenUDP(conn *net.UDPConn, via string, captures chan<- capture) {
+	buf := make([]byte, 1500)
+	var retry backoff
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			log.Fatalf("%s: %v", via, err)
+		}
+		if err != nil {
+			delay := retry.next()
+			log.Printf("%s: %v, retrying in %s", via, err, delay)
+			time.Sleep(delay)
+			continue
+		}
+		retry.reset()
+		captures <- capture{via: via, source: addr.String(), payload: append([]byte(nil), buf[:n]...)}
+	}
+}
+
+// backoff paces retries after read errors, so an error that persists, such
+// as the interface going away, does not turn a listener into a busy loop.
+type backoff struct {
+	delay time.Duration
+}
+
+// next returns how long to wait before the next retry, doubling from 100ms
+// up to 10s.
+func (b *backoff) next() time.Duration {
+	switch {
+	case b.delay == 0:
+		b.delay = 100 * time.Millisecond
+	case b.delay < 10*time.Second:
+		b.delay *= 2
+		if b.delay > 10*time.Second {
+			b.delay = 10 * time.Second
+		}
+	}
+	return b.delay
+}
+
+// reset starts over after a successful read.
+func (b *backoff) reset() {
+	b.delay = 0
+}
+
+func loadDevices(path string) ([]device.Computer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var devices []device.Computer
+	if err := json.Unmarshal(data, &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+func describePassword(password []byte) string {
+	if len(password) == 0 {
+		return "no SecureOn password"
+	}
+	return fmt.Sprintf("SecureOn password present (%d bytes)", len(password))
+}
+
+func matchDevice(devices []device.Computer, mac net.HardwareAddr) string {
+	for _, dev := range devices {
+		if dev.MAC.HardwareAddr().String() == mac.String() {
+			return fmt.Sprintf("matches device %q", dev.Name)
+		}
+	}
+	return "no matching device"
+}
@@ -0,0 +1,72 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/eblancof/telegram-bot/pkg/magicpacket"
+)
+
+// ethernetHeaderLen is the size of the destination, source and EtherType
+// fields that precede the payload of a frame.
+const ethernetHeaderLen = 14
+
+// listenRaw captures EtherType 0x0842 frames on ifaceName, or on every
+// interface when ifaceName is empty.
+func listenRaw(ifaceName string, captures chan<- capture) error {
+	protocol := htons(magicpacket.EtherType)
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(protocol))
+	if err != nil {
+		return err
+	}
+
+	via := "ethernet"
+	if ifaceName != "" {
+		iface, err := net.InterfaceByName(ifaceName)
+		if err != nil {
+			syscall.Close(fd)
+			return err
+		}
+		if err := syscall.Bind(fd, &syscall.SockaddrLinklayer{Protocol: protocol, Ifindex: iface.Index}); err != nil {
+			syscall.Close(fd)
+			return err
+		}
+		via = fmt.Sprintf("ethernet/%s", ifaceName)
+	}
+
+	go func() {
+		defer syscall.Close(fd)
+		buf := make([]byte, 1514)
+		var retry backoff
+		for {
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			switch {
+			case err == syscall.EINTR:
+				continue
+			case err == syscall.EBADF:
+				log.Fatalf("%s: %v", via, err)
+			case err != nil:
+				delay := retry.next()
+				log.Printf("%s: %v, retrying in %s", via, err, delay)
+				time.Sleep(delay)
+				continue
+			}
+			retry.reset()
+			if n < ethernetHeaderLen {
+				continue
+			}
+			source := net.HardwareAddr(buf[6:12]).String()
+			captures <- capture{via: via, source: source, payload: append([]byte(nil), buf[ethernetHeaderLen:n]...)}
+		}
+	}()
+	return nil
+}
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "github.com/eblancof/telegram-bot/pkg/magicpacket"
+
+func listenRaw(ifaceName string, captures chan<- capture) error {
+	return magicpacket.ErrRawUnsupported
+}
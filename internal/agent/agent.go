@@ -0,0 +1,140 @@
+// Package agent defines the protocol spoken between the bot server and the
+// companion agent running on the devices it wakes.
+//
+// Agents POST a Heartbeat to HeartbeatPath every few seconds, authenticated
+// with "Authorization: Bearer <secret>". The reply lists the commands
+// queued for the agent, whose outcome is POSTed to ResultPath.
+//
+// The wolcheck helper POSTs a WoLReport to WoLPath with the shared secret.
+//
+// Relays long-poll RelayPollPath with the shared secret and receive the
+// WakeRequests to send on their LAN, reporting a WakeResult to
+// RelayResultPath.
+//
+// New machines POST an Enrollment to EnrollPath, authenticated with a
+// one-time token issued by the bot instead of the shared secret.
+package agent
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	HeartbeatPath = "/agent/heartbeat"
+	ResultPath    = "/agent/result"
+	EnrollPath    = "/agent/enroll"
+	WoLPath       = "/agent/wol"
+
+	RelayPollPath   = "/relay/poll"
+	RelayResultPath = "/relay/result"
+)
+
+// RelayPollTimeout is how long the server holds a relay poll open when no
+// wake is pending.
+const RelayPollTimeout = 25 * time.Second
+
+// Heartbeat tells the server an agent is alive.
+type Heartbeat struct {
+	// Name is the device name the agent reports for.
+	Name     string `json:"name"`
+	Hostname string `json:"hostname"`
+	OS       string `json:"os"`
+	Version  string `json:"version,omitempty"`
+	// Interval is how long until the next heartbeat, used to decide when
+	// the agent is considered gone.
+	Interval time.Duration `json:"interval"`
+	// Actions lists the power actions the agent can perform.
+	Actions []string `json:"actions"`
+}
+
+// Command asks an agent to perform a power action.
+type Command struct {
+	ID     string `json:"id"`
+	Action string `json:"action"`
+}
+
+// HeartbeatResponse carries the commands queued for an agent.
+type HeartbeatResponse struct {
+	Commands []Command `json:"commands,omitempty"`
+}
+
+// Result reports the outcome of a Command.
+type Result struct {
+	Name   string `json:"name"`
+	ID     string `json:"id"`
+	OK     bool   `json:"ok"`
+	Output string `json:"output,omitempty"`
+}
+
+// WoLReport describes the Wake-on-LAN settings of a device's interface.
+type WoLReport struct {
+	Name      string `json:"name"`
+	Interface string `json:"interface"`
+	MAC       string `json:"mac"`
+	// Supported and Enabled list wake modes such as "magic" or "phy".
+	Supported []string `json:"supported,omitempty"`
+	Enabled   []string `json:"enabled,omitempty"`
+	// Armed reports whether a magic packet would wake the device.
+	Armed bool `json:"armed"`
+	// Error is set when the settings could not be read.
+	Error string `json:"error,omitempty"`
+}
+
+// RelayPoll asks for the wakes queued for a relay.
+type RelayPoll struct {
+	Name string `json:"name"`
+}
+
+// RelayPollResponse carries the wakes a relay should send.
+type RelayPollResponse struct {
+	Requests []WakeRequest `json:"requests,omitempty"`
+}
+
+// WakeRequest asks a relay to send magic packets on its LAN. An empty
+// Address and Interface mean every local broadcast address.
+type WakeRequest struct {
+	ID            string `json:"id"`
+	MAC           string `json:"mac"`
+	SecureOn      string `json:"secureon,omitempty"`
+	Transport     string `json:"transport,omitempty"`
+	Address       string `json:"address,omitempty"`
+	Port          int    `json:"port"`
+	Interface     string `json:"interface,omitempty"`
+	AllInterfaces bool   `json:"all_interfaces,omitempty"`
+	Count         int    `json:"count"`
+	IntervalMs    int    `json:"interval_ms"`
+}
+
+// WakeResult reports how many packets a relay sent for a WakeRequest, out of
+// how many it attempted.
+type WakeResult struct {
+	Relay     string `json:"relay"`
+	ID        string `json:"id"`
+	Sent      int    `json:"sent"`
+	Attempted int    `json:"attempted,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Enrollment asks for a machine to be added to the bot's devices.
+type Enrollment struct {
+	Hostname  string `json:"hostname"`
+	OS        string `json:"os"`
+	Interface string `json:"interface"`
+	MAC       string `json:"mac"`
+	IP        string `json:"ip"`
+}
+
+// Authorized reports whether r carries the bearer token secret. An empty
+// secret never authorizes.
+func Authorized(r *http.Request, secret string) bool {
+	token, ok := BearerToken(r)
+	return ok && secret != "" && subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+}
+
+// BearerToken returns the bearer token r is authenticated with.
+func BearerToken(r *http.Request) (string, bool) {
+	return strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Client talks to the bot server on behalf of an agent or enrolling machine.
+type Client struct {
+	HTTP   *http.Client
+	Server string
+	// Token is the shared secret or the enrollment token.
+	Token string
+}
+
+// NewClient returns a client for server. caFile, when set, is a PEM
+// certificate to trust instead of the system roots, for self-signed servers.
+func NewClient(server, token, caFile string) (*Client, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", caFile)
+		}
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	}
+	return &Client{HTTP: client, Server: strings.TrimSuffix(server, "/"), Token: token}, nil
+}
+
+// Post sends v as JSON to path and decodes the reply into out, if not nil.
+func (c *Client) Post(path string, v, out interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.Server+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("server replied %s", resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,48 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+)
+
+// PrimaryInterface returns the interface, and its address, that traffic to
+// server leaves from. Connecting a UDP socket sends nothing; it only picks
+// the route.
+func PrimaryInterface(server string) (net.Interface, net.IP, error) {
+	u, err := url.Parse(server)
+	if err != nil || u.Hostname() == "" {
+		return net.Interface{}, nil, fmt.Errorf("invalid server URL %q", server)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+	conn, err := net.Dial("udp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return net.Interface{}, nil, err
+	}
+	local := conn.LocalAddr().(*net.UDPAddr).IP
+	conn.Close()
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return net.Interface{}, nil, err
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(local) {
+				if len(iface.HardwareAddr) != 6 {
+					return net.Interface{}, nil, fmt.Errorf("%s has no Ethernet MAC address", iface.Name)
+				}
+				return iface, local, nil
+			}
+		}
+	}
+	return net.Interface{}, nil, errors.New("no interface has address " + local.String())
+}
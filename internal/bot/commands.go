@@ -13,6 +13,13 @@ const botCommandsList = `
 	{"command":"modify","description":"Modify existing device"},
 	{"command":"delete","description":"Delete a device"},
 	{"command":"list","description":"List all devices"},
+	{"command":"status","description":"Show which devices are online"},
+	{"command":"network","description":"Show network settings"},
+	{"command":"shutdown","description":"Shut down a device"},
+	{"command":"reboot","description":"Reboot a device"},
+	{"command":"sleep","description":"Put a device to sleep"},
+	{"command":"cycle","description":"Power cycle a device"},
+	{"command":"enroll","description":"Let a new machine add itself"},
 	{"command":"help","description":"Show available options"}
 ]`
 
@@ -0,0 +1,107 @@
+package bot
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/eblancof/telegram-bot/internal/config"
+	"github.com/eblancof/telegram-bot/internal/device"
+	"github.com/eblancof/telegram-bot/internal/hub"
+	"github.com/eblancof/telegram-bot/internal/probe"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// enrollTokenTTL is how long an /enroll token can be used.
+const enrollTokenTTL = 15 * time.Minute
+
+// StartEnrollment asks the admin to approve every machine that enrolls
+// itself through the agent hub.
+func StartEnrollment(bot *tgbotapi.BotAPI) {
+	hub.OnEnroll(func(p hub.Pending) {
+		msg := tgbotapi.NewMessage(config.GetChatID(), fmt.Sprintf(
+			"🆕 %s wants to be added:\nOS: %s\nInterface: %s\nMAC: %s\nIP: %s",
+			p.Hostname, p.OS, p.Interface, p.MAC, p.IP))
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("✅ Approve", fmt.Sprintf("%s:%s", cmdEnrollApprove, p.ID)),
+				tgbotapi.NewInlineKeyboardButtonData("❌ Reject", fmt.Sprintf("%s:%s", cmdEnrollReject, p.ID)),
+			),
+		)
+		bot.Send(msg)
+	})
+}
+
+// sendEnrollToken issues a one-time token and explains how to enroll a
+// machine with it.
+func sendEnrollToken(bot *tgbotapi.BotAPI, chatID int64) {
+	listen := config.GetAgentListen()
+	if listen == "" {
+		bot.Send(tgbotapi.NewMessage(chatID, "Enrollment needs the agent hub. Set AGENT_LISTEN and AGENT_SECRET and restart the bot."))
+		return
+	}
+
+	scheme := "http"
+	if config.GetAgentTLSCert() != "" {
+		scheme = "https"
+	}
+	_, port, _ := net.SplitHostPort(listen)
+	token := hub.IssueToken(enrollTokenTTL)
+	bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf(
+		"Run this on the new machine within %s:\n\nwol-enroll -server %s://BOT_HOST:%s -token %s\n\n"+
+			"The token works once. You will be asked to approve the machine here.",
+		humanDuration(enrollTokenTTL), scheme, port, token)))
+}
+
+// handleEnrollment approves or rejects the pending enrollment with id.
+func handleEnrollment(bot *tgbotapi.BotAPI, chatID int64, id string, approve bool) {
+	p, ok := hub.TakeEnrollment(id)
+	if !ok {
+		bot.Send(tgbotapi.NewMessage(chatID, "This enrollment was already handled."))
+		return
+	}
+	if !approve {
+		bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Enrollment of %s rejected.", p.Hostname)))
+		return
+	}
+
+	for _, dev := range device.Devices {
+		if dev.MAC == p.MAC {
+			bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("%s already uses MAC %s. Enrollment ignored.", dev.Name, p.MAC)))
+			return
+		}
+	}
+
+	newDevice := device.Computer{
+		Name:  enrolledName(p.Hostname),
+		MAC:   p.MAC,
+		Host:  p.IP,
+		Probe: probe.TypeICMP,
+	}
+	device.Devices = append(device.Devices, newDevice)
+	device.SaveDevices()
+	bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf(
+		"Device added: %s (%s, %s). Use /modify to adjust it.", newDevice.Name, newDevice.MAC, newDevice.Host)))
+	updateKeyboard(bot, chatID)
+}
+
+// enrolledName derives a device name from hostname that is not taken yet
+// and does not break callback data.
+func enrolledName(hostname string) string {
+	base := strings.ReplaceAll(strings.TrimSpace(hostname), ":", "-")
+	name := base
+	for n := 2; ; n++ {
+		taken := false
+		for _, dev := range device.Devices {
+			if dev.Name == name {
+				taken = true
+				break
+			}
+		}
+		if !taken {
+			return name
+		}
+		name = fmt.Sprintf("%s-%d", base, n)
+	}
+}
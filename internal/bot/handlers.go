@@ -1,27 +1,43 @@
 package bot
 
 import (
-	"encoding/hex"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
-	"os"
+	"net/netip"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/eblancof/telegram-bot/internal/agent"
 	"github.com/eblancof/telegram-bot/internal/config"
 	"github.com/eblancof/telegram-bot/internal/device"
+	"github.com/eblancof/telegram-bot/internal/hub"
+	"github.com/eblancof/telegram-bot/internal/monitor"
+	"github.com/eblancof/telegram-bot/internal/netif"
+	"github.com/eblancof/telegram-bot/internal/probe"
+	"github.com/eblancof/telegram-bot/internal/remote"
+	"github.com/eblancof/telegram-bot/internal/wol"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 const (
-	port        = 9
-	dataFile    = "devices.json"
 	cmdWOL      = "wol"
 	cmdAdd      = "add"
 	cmdModify   = "modify"
 	cmdDelete   = "delete"
 	cmdCancel   = "cancel"
 	cmdList     = "list"
+	cmdNetwork  = "network"
+	cmdStatus   = "status"
+	cmdShutdown = "shutdown"
+	cmdReboot   = "reboot"
+	cmdSleep    = "sleep"
+	cmdCycle    = "cycle"
+	cmdEnroll   = "enroll"
 	botCommands = `
 [
     {"command":"wol","description":"Wake up a device"},
@@ -29,56 +45,117 @@ const (
     {"command":"modify","description":"Modify existing device"},
     {"command":"delete","description":"Delete a device"},
     {"command":"list","description":"List all devices"},
+    {"command":"status","description":"Show which devices are online"},
+    {"command":"network","description":"Show network settings"},
+    {"command":"shutdown","description":"Shut down a device"},
+    {"command":"reboot","description":"Reboot a device"},
+    {"command":"sleep","description":"Put a device to sleep"},
+    {"command":"cycle","description":"Power cycle a device"},
+    {"command":"enroll","description":"Let a new machine add itself"},
     {"command":"help","description":"Show available options"}
 ]`
 	cmdAddName      = "add_name"
 	cmdAddMAC       = "add_mac"
+	cmdAddSecureOn  = "add_secureon"
+	cmdAddTarget    = "add_target"
 	cmdModifyName   = "modify_name"
 	cmdModifyMAC    = "modify_mac"
 	cmdModifyDevice = "modify_device"
-)
 
-var devices []device.Computer
+	cmdModifySecureOn  = "modify_secureon"
+	cmdModifyTarget    = "modify_target"
+	cmdModifyTransport = "modify_transport"
+	cmdSetTransport    = "set_transport"
+	cmdModifyInterface = "modify_interface"
+	cmdModifyBurst     = "modify_burst"
+	cmdModifyProbe     = "modify_probe"
+	cmdToggleNotify    = "toggle_notify"
+	cmdWakeUntilUp     = "wol_retry"
+	cmdStopWake        = "wol_stop"
+	cmdModifySSH       = "modify_ssh"
+	cmdModifyPowerCmds = "modify_power"
+	cmdPower           = "power"
+	cmdPowerConfirm    = "power_ok"
+	cmdEnrollApprove   = "enroll_ok"
+	cmdEnrollReject    = "enroll_no"
+	cmdModifyRelay     = "modify_relay"
+	cmdModifyBackend   = "modify_backend"
+	cmdModifyWake      = "modify_wake"
+	cmdSetWakeMethod   = "set_wake"
+
+	// clearValue is typed by the user to skip or clear an optional field.
+	clearValue = "-"
+	// allInterfacesValue is typed by the user to send on every interface.
+	allInterfacesValue = "*"
+)
 
-func loadDevices() error {
-	file, err := os.ReadFile(dataFile)
-	if err != nil {
-		return err
+// relayTimeout bounds how long a wake waits for its relay to report back.
+const relayTimeout = 30 * time.Second
+
+// sendWakeOnLAN sends the magic packet burst for dev, through its relay when
+// it has one, and returns how many packets were sent out of how many were
+// attempted.
+func sendWakeOnLAN(dev device.Computer) (sent, attempted int, err error) {
+	if dev.Relay != "" {
+		burst := wol.BurstSize(dev.BurstCount(), dev.BurstInterval())
+		ctx, cancel := context.WithTimeout(context.Background(), relayTimeout+dev.BurstInterval()*time.Duration(burst))
+		defer cancel()
+		result, err := hub.Wake(ctx, dev.Relay, agent.WakeRequest{
+			MAC:           dev.MAC.String(),
+			SecureOn:      dev.SecureOn,
+			Transport:     dev.Transport,
+			Address:       dev.Address,
+			Port:          dev.TargetPort(),
+			Interface:     dev.Interface,
+			AllInterfaces: dev.AllInterfaces,
+			Count:         dev.BurstCount(),
+			IntervalMs:    int(dev.BurstInterval() / time.Millisecond),
+		})
+		if result.Attempted == 0 {
+			// Relays built before WakeResult.Attempted only report Sent.
+			result.Attempted = burst
+		}
+		return result.Sent, result.Attempted, err
 	}
-	return json.Unmarshal(file, &devices)
-}
 
-func saveDevices() error {
-	data, err := json.MarshalIndent(devices, "", "  ")
-	if err != nil {
-		return err
+	address := dev.TargetAddress()
+	if dev.Transport == wol.TransportIPv6 {
+		// The global broadcast address is IPv4 only.
+		address = dev.Address
 	}
-	return os.WriteFile(dataFile, data, 0644)
+	return wol.SendWakeOnLAN(dev.MAC, dev.SecureOn, wol.Target{
+		Transport:     dev.Transport,
+		Address:       address,
+		Port:          dev.TargetPort(),
+		Interface:     dev.Interface,
+		Source:        dev.Source,
+		AllInterfaces: dev.UsesAllInterfaces(),
+		Count:         dev.BurstCount(),
+		Interval:      dev.BurstInterval(),
+	})
 }
 
-func sendWakeOnLAN(macAddress string) error {
-	mac, err := hex.DecodeString(strings.Replace(macAddress, ":", "", -1))
-	if err != nil {
-		return err
-	}
-
-	var packet []byte
-	packet = append(packet, []byte{255, 255, 255, 255, 255, 255}...)
-	for i := 0; i < 16; i++ {
-		packet = append(packet, mac...)
+// wakeResultText reports how many packets of a burst reached the network.
+func wakeResultText(dev device.Computer, result wakeResult) string {
+	var lines []string
+	if dev.WakesWithWoL() {
+		switch {
+		case result.sent == 0:
+			lines = append(lines, "Failed to send WoL packet to "+dev.Name)
+		case result.attempted > 1:
+			lines = append(lines, fmt.Sprintf("WoL packets sent to %s (%d/%d successful)", dev.Name, result.sent, result.attempted))
+		default:
+			lines = append(lines, "WoL packet sent to "+dev.Name)
+		}
 	}
-
-	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{
-		IP:   net.ParseIP(config.GetBroadcastIP()),
-		Port: port,
-	})
-	if err != nil {
-		return err
+	if dev.WakesWithPower() {
+		if result.poweredOn {
+			lines = append(lines, fmt.Sprintf("Power on of %s requested via %s", dev.Name, dev.PowerBackend))
+		} else {
+			lines = append(lines, fmt.Sprintf("Failed to power on %s via %s: %v", dev.Name, dev.PowerBackend, result.powerErr))
+		}
 	}
-	defer conn.Close()
-
-	_, err = conn.Write(packet)
-	return err
+	return strings.Join(lines, "\n")
 }
 
 func HandleMessages(bot *tgbotapi.BotAPI) {
@@ -93,6 +170,10 @@ func HandleMessages(bot *tgbotapi.BotAPI) {
 		}
 
 		if update.CallbackQuery != nil {
+			if update.CallbackQuery.Message == nil || update.CallbackQuery.Message.Chat.ID != config.GetChatID() {
+				bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, "Unauthorized"))
+				continue
+			}
 			handleCallbackQuery(bot, update.CallbackQuery)
 			continue
 		}
@@ -111,6 +192,12 @@ func HandleMessages(bot *tgbotapi.BotAPI) {
 }
 
 func handleCallbackQuery(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery) {
+	// The cancel button lives on the progress message, which must survive.
+	if query.Data == cmdStopWake {
+		stopWakeLoop(bot, query)
+		return
+	}
+
 	deleteMsg := tgbotapi.NewDeleteMessage(query.Message.Chat.ID, query.Message.MessageID)
 	bot.Send(deleteMsg)
 
@@ -120,19 +207,22 @@ func handleCallbackQuery(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery) {
 	switch data[0] {
 	case cmdWOL:
 		if len(data) > 1 {
-			for _, device := range devices {
-				if device.Name == data[1] {
-					err := sendWakeOnLAN(device.MAC)
-					replyText := "WoL packet sent to " + device.Name
-					if err != nil {
-						replyText = "Failed to send WoL packet"
-					}
-					bot.Send(tgbotapi.NewMessage(query.Message.Chat.ID, replyText))
+			for _, dev := range device.Devices {
+				if dev.Name == data[1] {
+					wakeDevice(bot, query.Message.Chat.ID, dev)
 				}
 			}
 		} else {
 			sendWolMessage(bot, query.Message.Chat.ID)
 		}
+	case cmdWakeUntilUp:
+		if len(data) > 1 {
+			for _, dev := range device.Devices {
+				if dev.Name == data[1] {
+					wakeUntilUp(bot, query.Message.Chat.ID, dev)
+				}
+			}
+		}
 	case cmdAdd:
 		startAddDevice(bot, query.Message.Chat.ID)
 	case cmdModify:
@@ -149,6 +239,78 @@ func handleCallbackQuery(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery) {
 		if len(data) > 1 {
 			startModifyMAC(bot, query.Message.Chat.ID, data[1])
 		}
+	case cmdModifySecureOn:
+		if len(data) > 1 {
+			startModifySecureOn(bot, query.Message.Chat.ID, data[1])
+		}
+	case cmdModifyTarget:
+		if len(data) > 1 {
+			startModifyTarget(bot, query.Message.Chat.ID, data[1])
+		}
+	case cmdModifyTransport:
+		if len(data) > 1 {
+			sendTransportOptionsMessage(bot, query.Message.Chat.ID, data[1])
+		}
+	case cmdModifyInterface:
+		if len(data) > 1 {
+			startModifyInterface(bot, query.Message.Chat.ID, data[1])
+		}
+	case cmdModifyBurst:
+		if len(data) > 1 {
+			startModifyBurst(bot, query.Message.Chat.ID, data[1])
+		}
+	case cmdModifyProbe:
+		if len(data) > 1 {
+			startModifyProbe(bot, query.Message.Chat.ID, data[1])
+		}
+	case cmdModifySSH:
+		if len(data) > 1 {
+			startModifySSH(bot, query.Message.Chat.ID, data[1])
+		}
+	case cmdModifyPowerCmds:
+		if len(data) > 1 {
+			startModifyPowerCommands(bot, query.Message.Chat.ID, data[1])
+		}
+	case cmdPower:
+		if len(data) > 2 {
+			sendPowerConfirm(bot, query.Message.Chat.ID, data[1], data[2])
+		}
+	case cmdPowerConfirm:
+		if len(data) > 2 {
+			for _, dev := range device.Devices {
+				if dev.Name == data[2] {
+					runPowerAction(bot, query.Message.Chat.ID, data[1], dev)
+				}
+			}
+		}
+	case cmdModifyBackend:
+		if len(data) > 1 {
+			startModifyBackend(bot, query.Message.Chat.ID, data[1])
+		}
+	case cmdModifyWake:
+		if len(data) > 1 {
+			sendWakeMethodOptions(bot, query.Message.Chat.ID, data[1])
+		}
+	case cmdSetWakeMethod:
+		if len(data) > 2 {
+			handleSetWakeMethod(bot, query.Message.Chat.ID, data[1], data[2])
+		}
+	case cmdModifyRelay:
+		if len(data) > 1 {
+			startModifyRelay(bot, query.Message.Chat.ID, data[1])
+		}
+	case cmdEnrollApprove, cmdEnrollReject:
+		if len(data) > 1 {
+			handleEnrollment(bot, query.Message.Chat.ID, data[1], data[0] == cmdEnrollApprove)
+		}
+	case cmdToggleNotify:
+		if len(data) > 1 {
+			handleToggleNotify(bot, query.Message.Chat.ID, data[1])
+		}
+	case cmdSetTransport:
+		if len(data) > 2 {
+			handleSetTransport(bot, query.Message.Chat.ID, data[1], data[2])
+		}
 	case cmdDelete:
 		if len(data) > 1 {
 			handleDeleteDevice(bot, data[1], query.Message.Chat.ID)
@@ -168,20 +330,89 @@ func sendUnauthorizedMessage(bot *tgbotapi.BotAPI, chatID int64) {
 }
 
 func sendDeviceList(bot *tgbotapi.BotAPI, chatID int64) {
-	if len(devices) == 0 {
+	if len(device.Devices) == 0 {
 		bot.Send(tgbotapi.NewMessage(chatID, "No devices found."))
 		return
 	}
 
 	var deviceList string
-	for _, device := range devices {
-		deviceList += fmt.Sprintf("📱 %s\nMAC: %s\n\n", device.Name, device.MAC)
+	for _, dev := range device.Devices {
+		deviceList += fmt.Sprintf("%s %s\nMAC: %s\n", statusDot(dev), dev.Name, dev.MAC)
+		if dev.SecureOn != "" {
+			deviceList += fmt.Sprintf("SecureOn: %s\n", maskSecureOn(dev.SecureOn))
+		}
+		deviceList += fmt.Sprintf("Target: %s\n", formatTarget(dev))
+		if iface := formatInterface(dev); iface != "" && (dev.Transport == "" || dev.Transport == wol.TransportUDP) {
+			deviceList += fmt.Sprintf("Interface: %s\n", iface)
+		}
+		if count := dev.BurstCount(); count > 1 {
+			deviceList += fmt.Sprintf("Packets: %d every %s\n", count, dev.BurstInterval())
+		}
+		if dev.HasProbe() {
+			deviceList += fmt.Sprintf("Probe: %s\n", formatProbe(dev))
+		}
+		if dev.Notify {
+			deviceList += "Notifications: on\n"
+		}
+		if dev.HasSSH() {
+			deviceList += fmt.Sprintf("SSH: %s\n", formatSSH(dev))
+		}
+		if dev.PowerBackend != "" {
+			deviceList += fmt.Sprintf("Power: %s\n", formatBackend(dev))
+		}
+		if a, ok := hub.Get(dev.Name); ok {
+			deviceList += fmt.Sprintf("Agent: %s (%s)\n", a.Hostname, a.OS)
+		}
+		if r, ok := hub.GetReadiness(dev.Name); ok {
+			if warning := readinessWarning(dev); warning != "" {
+				deviceList += warning + "\n"
+			} else {
+				deviceList += fmt.Sprintf("Wake-on-LAN: armed on %s\n", r.Interface)
+			}
+		}
+		deviceList += "\n"
 	}
 
 	msg := tgbotapi.NewMessage(chatID, "Saved Devices:\n\n"+deviceList)
 	bot.Send(msg)
 }
 
+func sendNetworkInfo(bot *tgbotapi.BotAPI, chatID int64) {
+	var text string
+	if detected := config.GetDetectedBroadcasts(); len(detected) > 0 {
+		text += "Broadcast addresses (detected, BROADCAST_IP not set):\n"
+		for _, addr := range detected {
+			text += fmt.Sprintf("• %s on %s (%s)\n", addr.Broadcast, addr.Name, addr.IP)
+		}
+	} else {
+		text += fmt.Sprintf("Broadcast address: %s\n", config.GetBroadcastIP())
+	}
+	text += fmt.Sprintf("Default port: %d\n", config.GetPort())
+
+	if relays := hub.Relays(); len(relays) > 0 {
+		text += "\nRelays:\n"
+		for _, r := range relays {
+			state := "connected"
+			if !r.Connected {
+				state = fmt.Sprintf("last seen %s ago", humanDuration(time.Since(r.LastSeen)))
+			}
+			text += fmt.Sprintf("• %s: %s\n", r.Name, state)
+		}
+	}
+
+	addrs, err := netif.InterfaceAddrs()
+	if err != nil {
+		text += "\nFailed to list network interfaces."
+	} else {
+		text += "\nInterfaces:\n"
+		for _, addr := range addrs {
+			text += fmt.Sprintf("• %s: %s, broadcast %s\n", addr.Name, addr.IP, addr.Broadcast)
+		}
+	}
+
+	bot.Send(tgbotapi.NewMessage(chatID, text))
+}
+
 func handleCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
 	switch message.Command() {
 	case "help":
@@ -196,6 +427,14 @@ func handleCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
 		sendDeleteMessage(bot, message.Chat.ID)
 	case cmdList:
 		sendDeviceList(bot, message.Chat.ID)
+	case cmdNetwork:
+		sendNetworkInfo(bot, message.Chat.ID)
+	case cmdStatus:
+		sendStatus(bot, message.Chat.ID)
+	case cmdShutdown, cmdReboot, cmdSleep, cmdCycle:
+		sendPowerMessage(bot, message.Chat.ID, message.Command())
+	case cmdEnroll:
+		sendEnrollToken(bot, message.Chat.ID)
 	default:
 		handleDefaultMessage(bot, message)
 	}
@@ -211,23 +450,36 @@ Available Commands:
 /modify - Modify existing device
 /delete - Delete a device
 /list - List all saved devices
+/status - Show which devices are online
+/network - Show broadcast addresses and interfaces
+/shutdown, /reboot, /sleep - Power a device off via its agent or SSH
+/cycle - Switch a device off and on again via its power backend
+/enroll - Get a one-time token for a new machine to add itself
 
 How to use:
 1. Quick Wake Up:
    • Use the keyboard buttons below to instantly wake up devices
    • Just tap a device name to wake it up
+   • Buttons show 🟢 online, 🔴 offline or ⏳ waking/not checked yet
 
 2. Device Management:
    • Add: Use /add and follow the prompts
-   • Modify: Use /modify to change name or MAC address
+   • Modify: Use /modify to change name, MAC address, SecureOn password, target address, transport (UDP, raw Ethernet or IPv6) sending interface, relay, packet burst, reachability probe, online/offline notifications, SSH access, power commands, power backend (Redfish, Tasmota or Shelly) or wake method
    • Delete: Use /delete to remove devices
    • List: Use /list to see all devices and their MACs
 
 3. Manual Wake Up:
    • Type a device name to wake it up
    • Use /wol command for button interface
+   • Use 🔁 Until up in /wol to keep resending until a device with a probe responds
 
-MAC Address Format: XX:XX:XX:XX:XX:XX
+MAC Address Format: XX:XX:XX:XX:XX:XX, XX-XX-XX-XX-XX-XX, xxxx.xxxx.xxxx or XXXXXXXXXXXX
+SecureOn Password Format: XX:XX:XX:XX:XX:XX or XX:XX:XX:XX (send - to skip or clear)
+Target Address Format: IP, IP:PORT or [IPv6]:PORT (send - to use the default broadcast address)
+Packet Burst Format: COUNT or COUNT INTERVAL, e.g. 3 500ms, at most 20 packets within 5s (send - to use the defaults)
+Probe Format: icmp HOST, tcp HOST:PORT or http URL (send - to disable)
+SSH Format: USER@HOST[:PORT] KEYTYPE HOSTKEY (send - to disable)
+Power Backend Format: redfish URL USER PASSWORD [insecure], tasmota URL [USER PASSWORD] or shelly URL [USER PASSWORD] (send - to remove)
 
 Note: The keyboard below updates automatically when you add/modify/delete devices.`
 
@@ -256,9 +508,14 @@ func sendWolMessage(bot *tgbotapi.BotAPI, chatID int64) {
 	msg := tgbotapi.NewMessage(chatID, "Select a device to wake up:")
 	var buttons [][]tgbotapi.InlineKeyboardButton
 
-	for _, device := range devices {
-		button := tgbotapi.NewInlineKeyboardButtonData(device.Name, fmt.Sprintf("%s:%s", cmdWOL, device.Name))
-		buttons = append(buttons, []tgbotapi.InlineKeyboardButton{button})
+	for _, dev := range device.Devices {
+		row := []tgbotapi.InlineKeyboardButton{
+			tgbotapi.NewInlineKeyboardButtonData(dev.Name, fmt.Sprintf("%s:%s", cmdWOL, dev.Name)),
+		}
+		if dev.HasProbe() {
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData("🔁 Until up", fmt.Sprintf("%s:%s", cmdWakeUntilUp, dev.Name)))
+		}
+		buttons = append(buttons, row)
 	}
 
 	buttons = append(buttons, []tgbotapi.InlineKeyboardButton{
@@ -281,8 +538,8 @@ func sendModifyMessage(bot *tgbotapi.BotAPI, chatID int64) {
 	msg := tgbotapi.NewMessage(chatID, "Select a device to modify:")
 	var buttons [][]tgbotapi.InlineKeyboardButton
 
-	for _, device := range devices {
-		button := tgbotapi.NewInlineKeyboardButtonData(device.Name, fmt.Sprintf("%s:%s", cmdModify, device.Name))
+	for _, dev := range device.Devices {
+		button := tgbotapi.NewInlineKeyboardButtonData(dev.Name, fmt.Sprintf("%s:%s", cmdModify, dev.Name))
 		buttons = append(buttons, []tgbotapi.InlineKeyboardButton{button})
 	}
 
@@ -304,6 +561,30 @@ func sendModifyOptionsMessage(bot *tgbotapi.BotAPI, chatID int64, deviceName str
 			tgbotapi.NewInlineKeyboardButtonData("Modify Name", fmt.Sprintf("%s:%s", cmdModifyName, deviceName)),
 			tgbotapi.NewInlineKeyboardButtonData("Modify MAC", fmt.Sprintf("%s:%s", cmdModifyMAC, deviceName)),
 		},
+		{
+			tgbotapi.NewInlineKeyboardButtonData("Modify SecureOn", fmt.Sprintf("%s:%s", cmdModifySecureOn, deviceName)),
+			tgbotapi.NewInlineKeyboardButtonData("Modify Target", fmt.Sprintf("%s:%s", cmdModifyTarget, deviceName)),
+		},
+		{
+			tgbotapi.NewInlineKeyboardButtonData("Modify Transport", fmt.Sprintf("%s:%s", cmdModifyTransport, deviceName)),
+			tgbotapi.NewInlineKeyboardButtonData("Modify Interface", fmt.Sprintf("%s:%s", cmdModifyInterface, deviceName)),
+		},
+		{
+			tgbotapi.NewInlineKeyboardButtonData("Modify Packet Burst", fmt.Sprintf("%s:%s", cmdModifyBurst, deviceName)),
+			tgbotapi.NewInlineKeyboardButtonData("Modify Probe", fmt.Sprintf("%s:%s", cmdModifyProbe, deviceName)),
+		},
+		{
+			tgbotapi.NewInlineKeyboardButtonData("Modify SSH", fmt.Sprintf("%s:%s", cmdModifySSH, deviceName)),
+			tgbotapi.NewInlineKeyboardButtonData("Power Commands", fmt.Sprintf("%s:%s", cmdModifyPowerCmds, deviceName)),
+		},
+		{
+			tgbotapi.NewInlineKeyboardButtonData("Power Backend", fmt.Sprintf("%s:%s", cmdModifyBackend, deviceName)),
+			tgbotapi.NewInlineKeyboardButtonData("Wake Method", fmt.Sprintf("%s:%s", cmdModifyWake, deviceName)),
+		},
+		{
+			tgbotapi.NewInlineKeyboardButtonData("Modify Relay", fmt.Sprintf("%s:%s", cmdModifyRelay, deviceName)),
+			tgbotapi.NewInlineKeyboardButtonData("Toggle Notifications", fmt.Sprintf("%s:%s", cmdToggleNotify, deviceName)),
+		},
 		{
 			tgbotapi.NewInlineKeyboardButtonData("❌ Cancel", cmdCancel),
 		},
@@ -321,8 +602,8 @@ func sendDeleteMessage(bot *tgbotapi.BotAPI, chatID int64) {
 	msg := tgbotapi.NewMessage(chatID, "Select a device to delete:")
 	var buttons [][]tgbotapi.InlineKeyboardButton
 
-	for _, device := range devices {
-		button := tgbotapi.NewInlineKeyboardButtonData(device.Name, fmt.Sprintf("%s:%s", cmdDelete, device.Name))
+	for _, dev := range device.Devices {
+		button := tgbotapi.NewInlineKeyboardButtonData(dev.Name, fmt.Sprintf("%s:%s", cmdDelete, dev.Name))
 		buttons = append(buttons, []tgbotapi.InlineKeyboardButton{button})
 	}
 
@@ -354,12 +635,13 @@ func handleDefaultMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
 }
 
 func handleModifyDeviceState(bot *tgbotapi.BotAPI, message *tgbotapi.Message, state *ModifyDeviceState) {
-	for i, device := range devices {
-		if device.Name == state.DeviceName {
+	for i, dev := range device.Devices {
+		if dev.Name == state.DeviceName {
 			switch state.Field {
 			case "name":
-				oldName := device.Name
-				devices[i].Name = message.Text
+				oldName := dev.Name
+				device.Devices[i].Name = message.Text
+				device.RenameBootTimes(oldName, message.Text)
 				msg := tgbotapi.NewMessage(message.Chat.ID,
 					fmt.Sprintf("Device name updated from %s to %s\nWould you like to modify the MAC address as well?", oldName, message.Text))
 				buttons := [][]tgbotapi.InlineKeyboardButton{
@@ -374,8 +656,8 @@ func handleModifyDeviceState(bot *tgbotapi.BotAPI, message *tgbotapi.Message, st
 					addButtonMessage(message.Chat.ID, sent.MessageID)
 				}
 			case "mac":
-				if validateMAC(message.Text) {
-					devices[i].MAC = message.Text
+				if mac, err := device.ParseMAC(message.Text); err == nil {
+					device.Devices[i].MAC = mac
 					msg := tgbotapi.NewMessage(message.Chat.ID,
 						fmt.Sprintf("MAC address updated for %s\nWould you like to modify the name as well?", state.DeviceName))
 					buttons := [][]tgbotapi.InlineKeyboardButton{
@@ -390,10 +672,165 @@ func handleModifyDeviceState(bot *tgbotapi.BotAPI, message *tgbotapi.Message, st
 						addButtonMessage(message.Chat.ID, sent.MessageID)
 					}
 				} else {
-					bot.Send(tgbotapi.NewMessage(message.Chat.ID, "Invalid MAC address format. Operation cancelled."))
+					bot.Send(tgbotapi.NewMessage(message.Chat.ID, invalidMACText(err)+" Operation cancelled."))
+				}
+			case "secureon":
+				// The password should not linger in the chat history.
+				bot.Send(tgbotapi.NewDeleteMessage(message.Chat.ID, message.MessageID))
+				if message.Text == clearValue {
+					device.Devices[i].SecureOn = ""
+					bot.Send(tgbotapi.NewMessage(message.Chat.ID,
+						fmt.Sprintf("SecureOn password cleared for %s", state.DeviceName)))
+				} else if password, err := wol.FormatSecureOn(message.Text); err == nil {
+					device.Devices[i].SecureOn = password
+					bot.Send(tgbotapi.NewMessage(message.Chat.ID,
+						fmt.Sprintf("SecureOn password updated for %s", state.DeviceName)))
+				} else {
+					bot.Send(tgbotapi.NewMessage(message.Chat.ID, "Invalid SecureOn password format. Operation cancelled."))
+				}
+			case "target":
+				if message.Text == clearValue {
+					device.Devices[i].Address, device.Devices[i].Port = "", 0
+				} else if address, targetPort, err := parseTarget(message.Text); err == nil {
+					device.Devices[i].Address, device.Devices[i].Port = address, targetPort
+				} else {
+					bot.Send(tgbotapi.NewMessage(message.Chat.ID, "Invalid target address. Operation cancelled."))
+					break
+				}
+				bot.Send(tgbotapi.NewMessage(message.Chat.ID,
+					fmt.Sprintf("Target for %s set to %s", state.DeviceName, formatTarget(device.Devices[i]))))
+			case "interface":
+				iface := message.Text
+				if iface == allInterfacesValue {
+					iface = ""
+				} else if _, err := net.InterfaceByName(iface); err != nil {
+					bot.Send(tgbotapi.NewMessage(message.Chat.ID, "Unknown network interface. Operation cancelled."))
+					break
+				}
+				switchTransport(&device.Devices[i], wol.TransportEthernet)
+				device.Devices[i].Interface, device.Devices[i].AllInterfaces = iface, iface == ""
+				device.Devices[i].Source = ""
+				bot.Send(tgbotapi.NewMessage(message.Chat.ID,
+					fmt.Sprintf("%s will be woken with raw Ethernet frames on %s", state.DeviceName, formatInterface(device.Devices[i]))))
+			case "ipv6":
+				addr, err := netip.ParseAddr(message.Text)
+				unicast := err == nil && addr.Is6() && !addr.Is4In6()
+				if !unicast && message.Text != allInterfacesValue {
+					if _, err := net.InterfaceByName(message.Text); err != nil {
+						bot.Send(tgbotapi.NewMessage(message.Chat.ID, "Invalid IPv6 address or interface. Operation cancelled."))
+						break
+					}
+				}
+				switchTransport(&device.Devices[i], wol.TransportIPv6)
+				switch {
+				case unicast:
+					device.Devices[i].Address, device.Devices[i].AllInterfaces = message.Text, false
+				case message.Text == allInterfacesValue:
+					device.Devices[i].Address, device.Devices[i].Interface, device.Devices[i].AllInterfaces = "", "", true
+				default:
+					device.Devices[i].Address, device.Devices[i].Interface, device.Devices[i].AllInterfaces = "", message.Text, false
+				}
+				device.Devices[i].Source = ""
+				bot.Send(tgbotapi.NewMessage(message.Chat.ID,
+					fmt.Sprintf("%s will be woken via %s", state.DeviceName, formatTarget(device.Devices[i]))))
+			case "probe":
+				if err := applyProbe(&device.Devices[i], message.Text); err != nil {
+					bot.Send(tgbotapi.NewMessage(message.Chat.ID, "Invalid probe. Operation cancelled."))
+					break
+				}
+				if device.Devices[i].HasProbe() {
+					bot.Send(tgbotapi.NewMessage(message.Chat.ID,
+						fmt.Sprintf("%s will be probed with %s after a wake", state.DeviceName, formatProbe(device.Devices[i]))))
+				} else {
+					bot.Send(tgbotapi.NewMessage(message.Chat.ID,
+						fmt.Sprintf("Probe disabled for %s", state.DeviceName)))
+				}
+			case "backend":
+				// The message carries a password.
+				bot.Request(tgbotapi.NewDeleteMessage(message.Chat.ID, message.MessageID))
+				if err := applyBackend(&device.Devices[i], message.Text); err != nil {
+					bot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("Invalid power backend (%v). Operation cancelled.", err)))
+					break
+				}
+				if device.Devices[i].PowerBackend != "" {
+					bot.Send(tgbotapi.NewMessage(message.Chat.ID,
+						fmt.Sprintf("%s: %s", state.DeviceName, formatBackend(device.Devices[i]))))
+				} else {
+					bot.Send(tgbotapi.NewMessage(message.Chat.ID,
+						fmt.Sprintf("Power backend removed from %s", state.DeviceName)))
+				}
+			case "relay":
+				if message.Text == clearValue {
+					device.Devices[i].Relay = ""
+				} else if strings.ContainsAny(message.Text, " :") {
+					bot.Send(tgbotapi.NewMessage(message.Chat.ID, "Invalid relay name. Operation cancelled."))
+					break
+				} else {
+					device.Devices[i].Relay = message.Text
+				}
+				bot.Send(tgbotapi.NewMessage(message.Chat.ID,
+					fmt.Sprintf("%s will be woken via %s", state.DeviceName, formatTarget(device.Devices[i]))))
+			case "ssh":
+				if err := applySSH(&device.Devices[i], message.Text); err != nil {
+					bot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("Invalid SSH access (%v). Operation cancelled.", err)))
+					break
+				}
+				if device.Devices[i].HasSSH() {
+					bot.Send(tgbotapi.NewMessage(message.Chat.ID,
+						fmt.Sprintf("%s can be powered off via %s", state.DeviceName, formatSSH(device.Devices[i]))))
+				} else {
+					bot.Send(tgbotapi.NewMessage(message.Chat.ID,
+						fmt.Sprintf("SSH access disabled for %s", state.DeviceName)))
+				}
+			case "power":
+				if err := applyPowerCommands(&device.Devices[i], message.Text); err != nil {
+					bot.Send(tgbotapi.NewMessage(message.Chat.ID, "Invalid power commands. Operation cancelled."))
+					break
+				}
+				var text string
+				for _, action := range []string{remote.ActionShutdown, remote.ActionReboot, remote.ActionSleep} {
+					command, _ := remote.Command(device.Devices[i], action)
+					text += fmt.Sprintf("\n%s: %s", action, command)
+				}
+				bot.Send(tgbotapi.NewMessage(message.Chat.ID, "Power commands for "+state.DeviceName+":"+text))
+			case "burst":
+				if message.Text == clearValue {
+					device.Devices[i].PacketCount, device.Devices[i].PacketIntervalMs = 0, 0
+				} else if count, interval, err := parseBurst(message.Text); err == nil {
+					device.Devices[i].PacketCount = count
+					device.Devices[i].PacketIntervalMs = int(interval / time.Millisecond)
+				} else {
+					bot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("Invalid packet burst (%v). Operation cancelled.", err)))
+					break
+				}
+				bot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("%s will be sent %d packet(s) every %s",
+					state.DeviceName, device.Devices[i].BurstCount(), device.Devices[i].BurstInterval())))
+			case "bind":
+				if message.Text != clearValue && message.Text != allInterfacesValue && net.ParseIP(message.Text) == nil {
+					if _, err := net.InterfaceByName(message.Text); err != nil {
+						bot.Send(tgbotapi.NewMessage(message.Chat.ID, "Unknown network interface. Operation cancelled."))
+						break
+					}
+				}
+				device.Devices[i].Interface, device.Devices[i].Source, device.Devices[i].AllInterfaces = "", "", false
+				switch {
+				case message.Text == clearValue:
+				case message.Text == allInterfacesValue:
+					device.Devices[i].AllInterfaces = true
+				case net.ParseIP(message.Text) != nil:
+					device.Devices[i].Source = message.Text
+				default:
+					device.Devices[i].Interface = message.Text
+				}
+				if iface := formatInterface(device.Devices[i]); iface != "" {
+					bot.Send(tgbotapi.NewMessage(message.Chat.ID,
+						fmt.Sprintf("%s will be woken via %s", state.DeviceName, iface)))
+				} else {
+					bot.Send(tgbotapi.NewMessage(message.Chat.ID,
+						fmt.Sprintf("%s will be woken via the default route", state.DeviceName)))
 				}
 			}
-			saveDevices()
+			device.SaveDevices()
 			updateKeyboard(bot, message.Chat.ID)
 			delete(modifyDeviceStates, message.Chat.ID)
 			return
@@ -404,14 +841,9 @@ func handleModifyDeviceState(bot *tgbotapi.BotAPI, message *tgbotapi.Message, st
 }
 
 func checkAndSendWolPacket(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
-	for _, device := range devices {
-		if message.Text == device.Name {
-			err := sendWakeOnLAN(device.MAC)
-			if err != nil {
-				bot.Send(tgbotapi.NewMessage(message.Chat.ID, "Failed to send WoL packet."))
-			} else {
-				bot.Send(tgbotapi.NewMessage(message.Chat.ID, "WoL packet sent to "+device.Name))
-			}
+	for _, dev := range device.Devices {
+		if trimStatus(message.Text) == dev.Name {
+			wakeDevice(bot, message.Chat.ID, dev)
 			break
 		}
 	}
@@ -432,31 +864,32 @@ func processDeviceCommand(bot *tgbotapi.BotAPI, text string, chatID int64) {
 }
 
 func handleAddDevice(bot *tgbotapi.BotAPI, parts []string, chatID int64) {
-	newDevice := device.Computer{Name: parts[0], MAC: parts[1]}
-	if validateMAC(newDevice.MAC) {
-		devices = append(devices, newDevice)
-		saveDevices()
-		bot.Send(tgbotapi.NewMessage(chatID, "Device added: "+newDevice.Name))
-		updateKeyboard(bot, chatID)
-	} else {
-		bot.Send(tgbotapi.NewMessage(chatID, "Invalid MAC address format."))
+	mac, err := device.ParseMAC(parts[1])
+	if err != nil {
+		bot.Send(tgbotapi.NewMessage(chatID, invalidMACText(err)))
+		return
 	}
+	newDevice := device.Computer{Name: parts[0], MAC: mac}
+	device.Devices = append(device.Devices, newDevice)
+	device.SaveDevices()
+	bot.Send(tgbotapi.NewMessage(chatID, "Device added: "+newDevice.Name))
+	updateKeyboard(bot, chatID)
 }
 
 func handleModifyDevice(bot *tgbotapi.BotAPI, parts []string, chatID int64) {
 	oldName := parts[0]
 	newName := parts[1]
-	newMAC := parts[2]
-	for i, device := range devices {
-		if device.Name == oldName {
-			if validateMAC(newMAC) {
-				devices[i].Name = newName
-				devices[i].MAC = newMAC
-				saveDevices()
+	for i, dev := range device.Devices {
+		if dev.Name == oldName {
+			if newMAC, err := device.ParseMAC(parts[2]); err == nil {
+				device.Devices[i].Name = newName
+				device.Devices[i].MAC = newMAC
+				device.RenameBootTimes(oldName, newName)
+				device.SaveDevices()
 				bot.Send(tgbotapi.NewMessage(chatID, "Device modified: "+newName))
 				updateKeyboard(bot, chatID)
 			} else {
-				bot.Send(tgbotapi.NewMessage(chatID, "Invalid MAC address format."))
+				bot.Send(tgbotapi.NewMessage(chatID, invalidMACText(err)))
 			}
 			return
 		}
@@ -465,10 +898,11 @@ func handleModifyDevice(bot *tgbotapi.BotAPI, parts []string, chatID int64) {
 }
 
 func handleDeleteDevice(bot *tgbotapi.BotAPI, deviceName string, chatID int64) {
-	for i, device := range devices {
-		if device.Name == deviceName {
-			devices = append(devices[:i], devices[i+1:]...)
-			saveDevices()
+	for i, dev := range device.Devices {
+		if dev.Name == deviceName {
+			device.Devices = append(device.Devices[:i], device.Devices[i+1:]...)
+			device.SaveDevices()
+			device.ForgetBootTimes(deviceName)
 			bot.Send(tgbotapi.NewMessage(chatID, "Device deleted: "+deviceName))
 			updateKeyboard(bot, chatID)
 			return
@@ -477,9 +911,12 @@ func handleDeleteDevice(bot *tgbotapi.BotAPI, deviceName string, chatID int64) {
 	bot.Send(tgbotapi.NewMessage(chatID, "Device not found."))
 }
 
-func validateMAC(mac string) bool {
-	_, err := hex.DecodeString(strings.Replace(mac, ":", "", -1))
-	return err == nil
+// invalidMACText explains why a MAC address was rejected.
+func invalidMACText(err error) string {
+	if errors.Is(err, device.ErrGroupMAC) {
+		return "Multicast and broadcast MAC addresses cannot be woken."
+	}
+	return "Invalid MAC address format."
 }
 
 func setBotCommands(bot *tgbotapi.BotAPI) error {
@@ -526,14 +963,11 @@ func handleAddDeviceState(bot *tgbotapi.BotAPI, message *tgbotapi.Message, state
 		}
 
 	case cmdAddMAC:
-		if validateMAC(message.Text) {
-			newDevice := device.Computer{Name: state.Name, MAC: message.Text}
-			devices = append(devices, newDevice)
-			saveDevices()
-			bot.Send(tgbotapi.NewMessage(message.Chat.ID,
-				fmt.Sprintf("Device added successfully!\nName: %s\nMAC: %s", newDevice.Name, newDevice.MAC)))
-			updateKeyboard(bot, message.Chat.ID)
-			delete(addDeviceStates, message.Chat.ID)
+		if mac, err := device.ParseMAC(message.Text); err == nil {
+			state.MAC = mac
+			state.Stage = cmdAddSecureOn
+			sendCancelPrompt(bot, message.Chat.ID,
+				"Please enter the SecureOn password (format: XX:XX:XX:XX:XX:XX or XX:XX:XX:XX), or send - to skip:")
 		} else {
 			msg := tgbotapi.NewMessage(message.Chat.ID,
 				"Invalid MAC address format. Please try again (format: XX:XX:XX:XX:XX:XX):")
@@ -548,6 +982,45 @@ func handleAddDeviceState(bot *tgbotapi.BotAPI, message *tgbotapi.Message, state
 				addButtonMessage(message.Chat.ID, sent.MessageID)
 			}
 		}
+
+	case cmdAddSecureOn:
+		bot.Send(tgbotapi.NewDeleteMessage(message.Chat.ID, message.MessageID))
+		if message.Text != clearValue {
+			password, err := wol.FormatSecureOn(message.Text)
+			if err != nil {
+				sendCancelPrompt(bot, message.Chat.ID,
+					"Invalid SecureOn password format. Please try again, or send - to skip:")
+				return
+			}
+			state.SecureOn = password
+		}
+		state.Stage = cmdAddTarget
+		sendCancelPrompt(bot, message.Chat.ID, fmt.Sprintf(
+			"Please enter the target address (format: IP or IP:PORT), or send - to use the default %s:%d:",
+			config.GetBroadcastIP(), config.GetPort()))
+
+	case cmdAddTarget:
+		newDevice := device.Computer{Name: state.Name, MAC: state.MAC, SecureOn: state.SecureOn}
+		if message.Text != clearValue {
+			address, targetPort, err := parseTarget(message.Text)
+			if err != nil {
+				sendCancelPrompt(bot, message.Chat.ID,
+					"Invalid target address. Please try again (format: IP or IP:PORT), or send - to use the default:")
+				return
+			}
+			newDevice.Address, newDevice.Port = address, targetPort
+		}
+
+		device.Devices = append(device.Devices, newDevice)
+		device.SaveDevices()
+		reply := fmt.Sprintf("Device added successfully!\nName: %s\nMAC: %s", newDevice.Name, newDevice.MAC)
+		if newDevice.SecureOn != "" {
+			reply += "\nSecureOn: " + maskSecureOn(newDevice.SecureOn)
+		}
+		reply += "\nTarget: " + formatTarget(newDevice)
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, reply))
+		updateKeyboard(bot, message.Chat.ID)
+		delete(addDeviceStates, message.Chat.ID)
 	}
 }
 
@@ -587,6 +1060,321 @@ func startModifyMAC(bot *tgbotapi.BotAPI, chatID int64, deviceName string) {
 	}
 }
 
+func startModifySecureOn(bot *tgbotapi.BotAPI, chatID int64, deviceName string) {
+	modifyDeviceStates[chatID] = &ModifyDeviceState{
+		DeviceName: deviceName,
+		Field:      "secureon",
+	}
+	sendCancelPrompt(bot, chatID, fmt.Sprintf(
+		"Enter the new SecureOn password for %s (format: XX:XX:XX:XX:XX:XX or XX:XX:XX:XX), or send - to clear it:", deviceName))
+}
+
+func startModifyTarget(bot *tgbotapi.BotAPI, chatID int64, deviceName string) {
+	modifyDeviceStates[chatID] = &ModifyDeviceState{
+		DeviceName: deviceName,
+		Field:      "target",
+	}
+	sendCancelPrompt(bot, chatID, fmt.Sprintf(
+		"Enter the new target address for %s (format: IP or IP:PORT), or send - to use the default %s:%d:",
+		deviceName, config.GetBroadcastIP(), config.GetPort()))
+}
+
+func sendTransportOptionsMessage(bot *tgbotapi.BotAPI, chatID int64, deviceName string) {
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("How should magic packets be sent to %s?", deviceName))
+	buttons := [][]tgbotapi.InlineKeyboardButton{
+		{
+			tgbotapi.NewInlineKeyboardButtonData("UDP", fmt.Sprintf("%s:%s:%s", cmdSetTransport, deviceName, wol.TransportUDP)),
+			tgbotapi.NewInlineKeyboardButtonData("Raw Ethernet", fmt.Sprintf("%s:%s:%s", cmdSetTransport, deviceName, wol.TransportEthernet)),
+			tgbotapi.NewInlineKeyboardButtonData("IPv6", fmt.Sprintf("%s:%s:%s", cmdSetTransport, deviceName, wol.TransportIPv6)),
+		},
+		{
+			tgbotapi.NewInlineKeyboardButtonData("❌ Cancel", cmdCancel),
+		},
+	}
+	msg.ReplyMarkup = tgbotapi.InlineKeyboardMarkup{InlineKeyboard: buttons}
+	sent, _ := bot.Send(msg)
+	if sent.MessageID != 0 {
+		addButtonMessage(chatID, sent.MessageID)
+	}
+}
+
+func handleSetTransport(bot *tgbotapi.BotAPI, chatID int64, deviceName, transport string) {
+	if transport == wol.TransportEthernet {
+		modifyDeviceStates[chatID] = &ModifyDeviceState{
+			DeviceName: deviceName,
+			Field:      "interface",
+		}
+		var names []string
+		if ifaces, err := net.Interfaces(); err == nil {
+			for _, iface := range ifaces {
+				if len(iface.HardwareAddr) == 6 {
+					names = append(names, iface.Name)
+				}
+			}
+		}
+		sendCancelPrompt(bot, chatID, fmt.Sprintf(
+			"Enter the network interface to send raw Ethernet frames on for %s (available: %s), or send * for all interfaces:",
+			deviceName, strings.Join(names, ", ")))
+		return
+	}
+	if transport == wol.TransportIPv6 {
+		modifyDeviceStates[chatID] = &ModifyDeviceState{
+			DeviceName: deviceName,
+			Field:      "ipv6",
+		}
+		sendCancelPrompt(bot, chatID, fmt.Sprintf(
+			"Enter an IPv6 unicast address for %s, or the interface to send to %s on (send * for all interfaces):",
+			deviceName, wol.IPv6AllNodes))
+		return
+	}
+
+	for i, dev := range device.Devices {
+		if dev.Name == deviceName {
+			switchTransport(&device.Devices[i], wol.TransportUDP)
+			device.SaveDevices()
+			bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("%s will be woken with UDP packets (%s)",
+				deviceName, formatTarget(device.Devices[i]))))
+			return
+		}
+	}
+	bot.Send(tgbotapi.NewMessage(chatID, "Device not found."))
+}
+
+// switchTransport makes dev use transport. Changing it clears the target
+// address and interface chosen for the previous transport, so an IPv6
+// address is not used as a UDP broadcast address, nor a raw Ethernet
+// interface as a UDP source.
+func switchTransport(dev *device.Computer, transport string) {
+	if transport == wol.TransportUDP {
+		transport = ""
+	}
+	if dev.Transport != transport {
+		dev.Address, dev.Interface, dev.Source, dev.AllInterfaces = "", "", "", false
+	}
+	dev.Transport = transport
+}
+
+func startModifyInterface(bot *tgbotapi.BotAPI, chatID int64, deviceName string) {
+	modifyDeviceStates[chatID] = &ModifyDeviceState{
+		DeviceName: deviceName,
+		Field:      "bind",
+	}
+	var names []string
+	if addrs, err := netif.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			names = append(names, fmt.Sprintf("%s (%s)", addr.Name, addr.IP))
+		}
+	}
+	sendCancelPrompt(bot, chatID, fmt.Sprintf(
+		"Enter the interface name or source IP to send from for %s (available: %s).\nSend * for all interfaces or - for the default route:",
+		deviceName, strings.Join(names, ", ")))
+}
+
+func startModifyBurst(bot *tgbotapi.BotAPI, chatID int64, deviceName string) {
+	modifyDeviceStates[chatID] = &ModifyDeviceState{
+		DeviceName: deviceName,
+		Field:      "burst",
+	}
+	sendCancelPrompt(bot, chatID, fmt.Sprintf(
+		"Enter how many packets to send to %s and optionally the interval between them (e.g. 3 500ms), or send - to use the default of %d every %s:",
+		deviceName, config.GetPacketCount(), config.GetPacketInterval()))
+}
+
+// parseBurst parses "COUNT" or "COUNT INTERVAL". An omitted interval is
+// returned as zero so the global default applies.
+func parseBurst(text string) (int, time.Duration, error) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || len(fields) > 2 {
+		return 0, 0, fmt.Errorf("invalid packet burst %q", text)
+	}
+
+	count, err := strconv.Atoi(fields[0])
+	if err != nil || count < 1 || count > config.MaxPacketCount {
+		return 0, 0, fmt.Errorf("invalid packet count %q", fields[0])
+	}
+
+	var interval time.Duration
+	effective := config.GetPacketInterval()
+	if len(fields) == 2 {
+		interval, err = time.ParseDuration(fields[1])
+		if err != nil || interval < time.Millisecond || interval > config.MaxBurstDuration {
+			return 0, 0, fmt.Errorf("invalid packet interval %q", fields[1])
+		}
+		effective = interval
+	}
+	if !config.BurstFits(count, effective) {
+		return 0, 0, fmt.Errorf("a burst may last at most %s", config.MaxBurstDuration)
+	}
+	return count, interval, nil
+}
+
+func startModifyProbe(bot *tgbotapi.BotAPI, chatID int64, deviceName string) {
+	modifyDeviceStates[chatID] = &ModifyDeviceState{
+		DeviceName: deviceName,
+		Field:      "probe",
+	}
+	sendCancelPrompt(bot, chatID, fmt.Sprintf(
+		"Enter how to check whether %s is up: icmp HOST, tcp HOST:PORT or http URL (e.g. tcp 192.168.1.10:22), or send - to disable:",
+		deviceName))
+}
+
+func handleToggleNotify(bot *tgbotapi.BotAPI, chatID int64, deviceName string) {
+	for i, dev := range device.Devices {
+		if dev.Name == deviceName {
+			device.Devices[i].Notify = !dev.Notify
+			device.SaveDevices()
+			switch {
+			case !device.Devices[i].Notify:
+				bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Notifications disabled for %s", deviceName)))
+			case monitor.Watches(dev):
+				bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("You will be notified when %s goes online or offline", deviceName)))
+			default:
+				bot.Send(tgbotapi.NewMessage(chatID,
+					fmt.Sprintf("Notifications enabled for %s. Configure a probe with /modify so its state can be checked.", deviceName)))
+			}
+			return
+		}
+	}
+	bot.Send(tgbotapi.NewMessage(chatID, "Device not found."))
+}
+
+// applyProbe parses "icmp HOST", "tcp HOST:PORT", "http URL" or "-" into
+// the probe fields of dev.
+func applyProbe(dev *device.Computer, text string) error {
+	if strings.TrimSpace(text) == clearValue {
+		dev.Probe, dev.Host, dev.ProbePort, dev.ProbeURL = "", "", 0, ""
+		return nil
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) != 2 {
+		return fmt.Errorf("invalid probe %q", text)
+	}
+
+	switch kind, arg := strings.ToLower(fields[0]), fields[1]; kind {
+	case probe.TypeICMP:
+		dev.Probe, dev.Host, dev.ProbePort, dev.ProbeURL = kind, arg, 0, ""
+	case probe.TypeTCP:
+		host, portText, err := net.SplitHostPort(arg)
+		if err != nil {
+			return err
+		}
+		p, err := strconv.Atoi(portText)
+		if err != nil || p <= 0 || p > 65535 {
+			return fmt.Errorf("invalid port %q", portText)
+		}
+		dev.Probe, dev.Host, dev.ProbePort, dev.ProbeURL = kind, host, p, ""
+	case probe.TypeHTTP:
+		u, err := url.Parse(arg)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid URL %q", arg)
+		}
+		dev.Probe, dev.Host, dev.ProbePort, dev.ProbeURL = kind, u.Hostname(), 0, arg
+	default:
+		return fmt.Errorf("unknown probe type %q", kind)
+	}
+	return nil
+}
+
+// formatProbe describes how dev is checked for reachability.
+func formatProbe(dev device.Computer) string {
+	switch dev.Probe {
+	case probe.TypeTCP:
+		return "tcp " + net.JoinHostPort(dev.Host, strconv.Itoa(dev.ProbePort))
+	case probe.TypeHTTP:
+		return "http " + dev.ProbeURL
+	}
+	return dev.Probe + " " + dev.Host
+}
+
+// sendCancelPrompt asks the user for input, offering a cancel button.
+func sendCancelPrompt(bot *tgbotapi.BotAPI, chatID int64, text string) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("❌ Cancel", cmdCancel),
+		),
+	)
+	sent, _ := bot.Send(msg)
+	if sent.MessageID != 0 {
+		addButtonMessage(chatID, sent.MessageID)
+	}
+}
+
+// parseTarget parses "IP", "IP:PORT" or ":PORT". An omitted part is returned
+// as its zero value so the global default applies.
+func parseTarget(text string) (string, int, error) {
+	text = strings.TrimSpace(text)
+	host, portText := text, ""
+	if _, err := netip.ParseAddr(text); err != nil && strings.Contains(text, ":") {
+		if host, portText, err = net.SplitHostPort(text); err != nil {
+			return "", 0, err
+		}
+	}
+
+	if host != "" {
+		if _, err := netip.ParseAddr(host); err != nil {
+			return "", 0, fmt.Errorf("invalid IP address %q", host)
+		}
+	}
+
+	var targetPort int
+	if portText != "" {
+		p, err := strconv.Atoi(portText)
+		if err != nil || p <= 0 || p > 65535 {
+			return "", 0, fmt.Errorf("invalid port %q", portText)
+		}
+		targetPort = p
+	}
+	return host, targetPort, nil
+}
+
+// formatTarget describes where magic packets for dev are sent.
+func formatTarget(dev device.Computer) string {
+	if dev.Relay != "" {
+		return formatRelayTarget(dev)
+	}
+	if dev.Transport == wol.TransportEthernet {
+		return fmt.Sprintf("raw Ethernet on %s", formatInterface(dev))
+	}
+	if dev.Transport == wol.TransportIPv6 {
+		switch {
+		case dev.Address != "":
+			return "IPv6 " + net.JoinHostPort(dev.Address, strconv.Itoa(dev.TargetPort()))
+		case dev.UsesAllInterfaces():
+			return fmt.Sprintf("IPv6 %s on every interface, port %d", wol.IPv6AllNodes, dev.TargetPort())
+		}
+		return fmt.Sprintf("IPv6 %s%%%s, port %d", wol.IPv6AllNodes, dev.Interface, dev.TargetPort())
+	}
+	if dev.UsesAllInterfaces() {
+		return fmt.Sprintf("broadcast on every interface, port %d", dev.TargetPort())
+	}
+	target := net.JoinHostPort(dev.TargetAddress(), strconv.Itoa(dev.TargetPort()))
+	if dev.Address == "" && dev.Port == 0 {
+		target += " (default)"
+	}
+	return target
+}
+
+// formatInterface describes which interface or source address packets for
+// dev leave from, or returns "" for the default route.
+func formatInterface(dev device.Computer) string {
+	switch {
+	case dev.AllInterfaces:
+		return "all interfaces"
+	case dev.Interface != "":
+		return dev.Interface
+	case dev.Source != "":
+		return "source " + dev.Source
+	}
+	return ""
+}
+
+// maskSecureOn hides every byte of a SecureOn password while keeping its length visible.
+func maskSecureOn(password string) string {
+	return strings.Repeat("•", len(strings.Replace(password, ":", "", -1))/2) + " (set)"
+}
+
 func addButtonMessage(chatID int64, messageID int) {
 	buttonMessages[chatID] = append(buttonMessages[chatID], messageID)
 }
@@ -601,31 +1389,44 @@ func cleanupButtonMessages(bot *tgbotapi.BotAPI, chatID int64) {
 	}
 }
 
-func createDeviceKeyboard() tgbotapi.ReplyKeyboardMarkup {
-	var rows [][]tgbotapi.KeyboardButton
-	var row []tgbotapi.KeyboardButton
-	if len(devices) == 0 {
-		return tgbotapi.NewReplyKeyboard(
-			tgbotapi.NewKeyboardButtonRow(
-				tgbotapi.NewKeyboardButton("/add"),
-			),
-		)
-	}
-
-	for i, device := range devices {
-		row = append(row, tgbotapi.NewKeyboardButton(device.Name))
+func updateKeyboard(bot *tgbotapi.BotAPI, chatID int64) {
+	msg := tgbotapi.NewMessage(chatID, "Keyboard updated with current devices.")
+	msg.ReplyMarkup = CreateDeviceKeyboard()
+	bot.Send(msg)
+}
 
-		if (i+1)%2 == 0 || i == len(devices)-1 {
-			rows = append(rows, row)
-			row = []tgbotapi.KeyboardButton{}
-		}
+// formatRelayTarget describes where the relay of dev sends its packets.
+func formatRelayTarget(dev device.Computer) string {
+	var where string
+	switch {
+	case dev.Transport == wol.TransportEthernet:
+		where = "raw Ethernet on " + formatInterface(dev)
+	case dev.Transport == wol.TransportIPv6 && dev.Address != "":
+		where = "IPv6 " + net.JoinHostPort(dev.Address, strconv.Itoa(dev.TargetPort()))
+	case dev.Transport == wol.TransportIPv6:
+		where = fmt.Sprintf("IPv6 %s, port %d", wol.IPv6AllNodes, dev.TargetPort())
+	case dev.Address != "":
+		where = net.JoinHostPort(dev.Address, strconv.Itoa(dev.TargetPort()))
+	case dev.Interface != "":
+		where = fmt.Sprintf("broadcast on %s, port %d", dev.Interface, dev.TargetPort())
+	default:
+		where = fmt.Sprintf("broadcast on every interface, port %d", dev.TargetPort())
 	}
-
-	return tgbotapi.NewReplyKeyboard(rows...)
+	return fmt.Sprintf("%s via relay %s", where, dev.Relay)
 }
 
-func updateKeyboard(bot *tgbotapi.BotAPI, chatID int64) {
-	msg := tgbotapi.NewMessage(chatID, "Keyboard updated with current devices.")
-	msg.ReplyMarkup = createDeviceKeyboard()
-	bot.Send(msg)
+func startModifyRelay(bot *tgbotapi.BotAPI, chatID int64, deviceName string) {
+	modifyDeviceStates[chatID] = &ModifyDeviceState{
+		DeviceName: deviceName,
+		Field:      "relay",
+	}
+	text := fmt.Sprintf("Enter the name of the relay that wakes %s, or send - to send from this server:", deviceName)
+	if relays := hub.Relays(); len(relays) > 0 {
+		names := make([]string, len(relays))
+		for i, r := range relays {
+			names[i] = r.Name
+		}
+		text += "\nKnown relays: " + strings.Join(names, ", ")
+	}
+	sendCancelPrompt(bot, chatID, text)
 }
@@ -0,0 +1,143 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/eblancof/telegram-bot/internal/config"
+	"github.com/eblancof/telegram-bot/internal/device"
+	"github.com/eblancof/telegram-bot/internal/wol"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		in      string
+		host    string
+		port    int
+		wantErr bool
+	}{
+		{"192.168.1.255", "192.168.1.255", 0, false},
+		{" 10.0.0.255:7 ", "10.0.0.255", 7, false},
+		{":9", "", 9, false},
+		{"fd00::10", "fd00::10", 0, false},
+		{"[fd00::10]:9", "fd00::10", 9, false},
+		{"[ff02::1]:7", "ff02::1", 7, false},
+		{"", "", 0, false},
+
+		// "-" resets the target before parseTarget is called, so here it
+		// is just an invalid address.
+		{clearValue, "", 0, true},
+		{"nas.lan", "", 0, true},
+		{"nas.lan:9", "", 0, true},
+		{"192.168.1.300", "", 0, true},
+		{"192.168.1.255:0", "", 0, true},
+		{"192.168.1.255:65536", "", 0, true},
+		{"192.168.1.255:wol", "", 0, true},
+		{"fd00::10]:9", "", 0, true},
+		{"[fd00::10]", "", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			host, port, err := parseTarget(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseTarget(%q) = %q, %d, want an error", tt.in, host, port)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTarget(%q): %v", tt.in, err)
+			}
+			if host != tt.host || port != tt.port {
+				t.Errorf("parseTarget(%q) = %q, %d, want %q, %d", tt.in, host, port, tt.host, tt.port)
+			}
+		})
+	}
+}
+
+func TestParseBurst(t *testing.T) {
+	// An omitted interval is checked against the default, read once by
+	// config.Load.
+	t.Setenv("WOL_PACKET_INTERVAL", "100ms")
+	if got := config.GetPacketInterval(); got != 100*time.Millisecond {
+		t.Skipf("default packet interval is %s, want 100ms", got)
+	}
+
+	tests := []struct {
+		in       string
+		count    int
+		interval time.Duration
+		wantErr  bool
+	}{
+		{"3", 3, 0, false},
+		{" 3  500ms ", 3, 500 * time.Millisecond, false},
+		{"1", 1, 0, false},
+		{"1 5s", 1, 5 * time.Second, false},
+		{"20", 20, 0, false},
+		{"20 250ms", 20, 250 * time.Millisecond, false},
+		{"6 1s", 6, time.Second, false},
+		{"2 1ms", 2, time.Millisecond, false},
+
+		{"", 0, 0, true},
+		{"0", 0, 0, true},
+		{"-1", 0, 0, true},
+		{"21", 0, 0, true},
+		{"three", 0, 0, true},
+		{"3 500", 0, 0, true},
+		{"3 0s", 0, 0, true},
+		{"3 999us", 0, 0, true},
+		{"2 6s", 0, 0, true},
+		{"7 1s", 0, 0, true},
+		{"20 300ms", 0, 0, true},
+		{"3 500ms extra", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			count, interval, err := parseBurst(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseBurst(%q) = %d, %s, want an error", tt.in, count, interval)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseBurst(%q): %v", tt.in, err)
+			}
+			if count != tt.count || interval != tt.interval {
+				t.Errorf("parseBurst(%q) = %d, %s, want %d, %s", tt.in, count, interval, tt.count, tt.interval)
+			}
+		})
+	}
+}
+
+func TestSwitchTransport(t *testing.T) {
+	udp := device.Computer{Address: "192.168.1.255", Port: 7, Source: "192.168.1.2"}
+	ethernet := device.Computer{Transport: wol.TransportEthernet, Interface: "eth0", Port: 7}
+	ipv6 := device.Computer{Transport: wol.TransportIPv6, Address: "fd00::10", Interface: "eth1", Port: 7}
+	allIPv6 := device.Computer{Transport: wol.TransportIPv6, AllInterfaces: true, Port: 7}
+
+	tests := []struct {
+		name      string
+		dev       device.Computer
+		transport string
+		want      device.Computer
+	}{
+		{"UDP to Ethernet", udp, wol.TransportEthernet, device.Computer{Transport: wol.TransportEthernet, Port: 7}},
+		{"IPv6 to UDP", ipv6, wol.TransportUDP, device.Computer{Port: 7}},
+		{"all interfaces IPv6 to UDP", allIPv6, wol.TransportUDP, device.Computer{Port: 7}},
+		{"Ethernet to IPv6", ethernet, wol.TransportIPv6, device.Computer{Transport: wol.TransportIPv6, Port: 7}},
+		// Choosing the current transport again keeps its settings.
+		{"UDP to UDP", udp, wol.TransportUDP, udp},
+		{"IPv6 to IPv6", ipv6, wol.TransportIPv6, ipv6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dev := tt.dev
+			switchTransport(&dev, tt.transport)
+			if !reflect.DeepEqual(dev, tt.want) {
+				t.Errorf("switchTransport(%+v, %q) = %+v, want %+v", tt.dev, tt.transport, dev, tt.want)
+			}
+		})
+	}
+}
@@ -1,16 +1,46 @@
 package bot
 
 import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eblancof/telegram-bot/internal/config"
 	"github.com/eblancof/telegram-bot/internal/device"
+	"github.com/eblancof/telegram-bot/internal/monitor"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+const dotWaking = "⏳"
+
+// keyboardQuiet is the least time between two keyboard refresh messages.
+// Changes within it are coalesced into a single refresh at its end.
+const keyboardQuiet = 2 * time.Minute
+
+var (
+	keyboardMu sync.Mutex
+	// keyboardLabels are the button labels of the keyboard last sent.
+	keyboardLabels []string
+	// lastRefresh is when a refresh message was last sent, refreshPending
+	// whether one is scheduled.
+	lastRefresh    time.Time
+	refreshPending bool
+
+	wakingMu sync.Mutex
+	waking   = make(map[string]bool)
+)
+
 func CreateDeviceKeyboard() tgbotapi.ReplyKeyboardMarkup {
 	var rows [][]tgbotapi.KeyboardButton
 	var row []tgbotapi.KeyboardButton
 
-	if len(device.Devices) == 0 {
+	labels := deviceLabels()
+	keyboardMu.Lock()
+	keyboardLabels = labels
+	keyboardMu.Unlock()
+
+	if len(labels) == 0 {
 		return tgbotapi.NewReplyKeyboard(
 			tgbotapi.NewKeyboardButtonRow(
 				tgbotapi.NewKeyboardButton("/add"),
@@ -18,10 +48,10 @@ func CreateDeviceKeyboard() tgbotapi.ReplyKeyboardMarkup {
 		)
 	}
 
-	for i, dev := range device.Devices {
-		row = append(row, tgbotapi.NewKeyboardButton(dev.Name))
+	for i, label := range labels {
+		row = append(row, tgbotapi.NewKeyboardButton(label))
 
-		if (i+1)%2 == 0 || i == len(device.Devices)-1 {
+		if (i+1)%2 == 0 || i == len(labels)-1 {
 			rows = append(rows, row)
 			row = []tgbotapi.KeyboardButton{}
 		}
@@ -29,3 +59,101 @@ func CreateDeviceKeyboard() tgbotapi.ReplyKeyboardMarkup {
 
 	return tgbotapi.NewReplyKeyboard(rows...)
 }
+
+// StartKeyboardRefresh resends the reply keyboard to the authorized chat
+// after a monitor round changed any of its status indicators.
+func StartKeyboardRefresh(bot *tgbotapi.BotAPI) {
+	monitor.OnRound(func() {
+		refreshKeyboard(bot)
+	})
+}
+
+// refreshKeyboard resends the reply keyboard when its labels changed, at
+// most once every keyboardQuiet. Replies that carry the keyboard anyway
+// bring it up to date in between, so a scheduled refresh often finds
+// nothing left to send.
+func refreshKeyboard(bot *tgbotapi.BotAPI) {
+	keyboardMu.Lock()
+	if refreshPending || equalLabels(keyboardLabels, deviceLabels()) {
+		keyboardMu.Unlock()
+		return
+	}
+	if wait := keyboardQuiet - time.Since(lastRefresh); wait > 0 {
+		refreshPending = true
+		keyboardMu.Unlock()
+		time.AfterFunc(wait, func() {
+			keyboardMu.Lock()
+			refreshPending = false
+			keyboardMu.Unlock()
+			refreshKeyboard(bot)
+		})
+		return
+	}
+	lastRefresh = time.Now()
+	keyboardMu.Unlock()
+
+	msg := tgbotapi.NewMessage(config.GetChatID(), "Device status updated.")
+	msg.ReplyMarkup = CreateDeviceKeyboard()
+	bot.Send(msg)
+}
+
+func deviceLabels() []string {
+	devices := device.All()
+	labels := make([]string, 0, len(devices))
+	for _, dev := range devices {
+		labels = append(labels, deviceLabel(dev))
+	}
+	return labels
+}
+
+// deviceLabel prefixes the name of dev with its live state. Devices without
+// a probe or agent keep their plain name.
+func deviceLabel(dev device.Computer) string {
+	wakingMu.Lock()
+	isWaking := waking[dev.Name]
+	wakingMu.Unlock()
+
+	switch {
+	case isWaking:
+		return dotWaking + " " + dev.Name
+	case !monitor.Watches(dev):
+		return dev.Name
+	}
+	if _, ok := monitor.Get(dev.Name); !ok {
+		return dotWaking + " " + dev.Name
+	}
+	return statusDot(dev) + " " + dev.Name
+}
+
+// trimStatus strips the status indicator a keyboard label may start with,
+// so labels from older keyboards still map to their device.
+func trimStatus(label string) string {
+	for _, dot := range []string{dotOnline, dotOffline, dotUnknown, dotWaking} {
+		if strings.HasPrefix(label, dot+" ") {
+			return strings.TrimPrefix(label, dot+" ")
+		}
+	}
+	return label
+}
+
+func setWaking(name string, isWaking bool) {
+	wakingMu.Lock()
+	defer wakingMu.Unlock()
+	if isWaking {
+		waking[name] = true
+	} else {
+		delete(waking, name)
+	}
+}
+
+func equalLabels(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
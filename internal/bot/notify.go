@@ -0,0 +1,93 @@
+package bot
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/eblancof/telegram-bot/internal/config"
+	"github.com/eblancof/telegram-bot/internal/device"
+	"github.com/eblancof/telegram-bot/internal/monitor"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// notification remembers the last state reported for a device.
+type notification struct {
+	online  bool
+	sentAt  time.Time
+	pending *time.Timer
+}
+
+var (
+	notificationsMu sync.Mutex
+	notifications   = make(map[string]*notification)
+)
+
+// StartNotifications tells the authorized chat whenever a device that opted
+// in goes online or offline. Changes within the cooldown of the previous
+// notification are held back and only reported if they still apply once it
+// has passed.
+func StartNotifications(bot *tgbotapi.BotAPI) {
+	monitor.OnChange(func(name string, status monitor.Status) {
+		notifyChange(bot, name)
+	})
+}
+
+func notifyChange(bot *tgbotapi.BotAPI, name string) {
+	dev, ok := findDevice(device.All(), name)
+	status, known := monitor.Get(name)
+	if !ok || !dev.Notify || !known {
+		return
+	}
+
+	notificationsMu.Lock()
+	defer notificationsMu.Unlock()
+
+	last := notifications[name]
+	send, wait := holdBack(last, status.Online, time.Now(), config.GetNotifyCooldown())
+	if wait > 0 && last.pending == nil {
+		last.pending = time.AfterFunc(wait, func() {
+			notificationsMu.Lock()
+			last.pending = nil
+			notificationsMu.Unlock()
+			notifyChange(bot, name)
+		})
+	}
+	if !send {
+		return
+	}
+
+	text := fmt.Sprintf("%s %s is offline", dotOffline, name)
+	if status.Online {
+		text = fmt.Sprintf("%s %s is online", dotOnline, name)
+	}
+	msg := tgbotapi.NewMessage(config.GetChatID(), text)
+	msg.ReplyMarkup = CreateDeviceKeyboard()
+	bot.Send(msg)
+	notifications[name] = &notification{online: status.Online, sentAt: time.Now()}
+}
+
+// holdBack decides whether a device now online or offline is reported at
+// now, given the last notification sent for it, if any. A change within
+// cooldown of that notification is not sent but retried after wait.
+func holdBack(last *notification, online bool, now time.Time, cooldown time.Duration) (send bool, wait time.Duration) {
+	if last == nil {
+		return true, 0
+	}
+	if last.online == online {
+		return false, 0
+	}
+	if wait := cooldown - now.Sub(last.sentAt); wait > 0 {
+		return false, wait
+	}
+	return true, 0
+}
+
+func findDevice(devices []device.Computer, name string) (device.Computer, bool) {
+	for _, dev := range devices {
+		if dev.Name == name {
+			return dev, true
+		}
+	}
+	return device.Computer{}, false
+}
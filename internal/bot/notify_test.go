@@ -0,0 +1,42 @@
+package bot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHoldBack(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	const cooldown = 5 * time.Minute
+	sentAgo := func(online bool, ago time.Duration) *notification {
+		return &notification{online: online, sentAt: now.Add(-ago)}
+	}
+
+	tests := []struct {
+		name   string
+		last   *notification
+		online bool
+		send   bool
+		wait   time.Duration
+	}{
+		{"first change", nil, false, true, 0},
+		{"same state", sentAgo(true, time.Hour), true, false, 0},
+		{"same state within cooldown", sentAgo(false, time.Second), false, false, 0},
+		{"flap within cooldown", sentAgo(true, time.Minute), false, false, 4 * time.Minute},
+		{"flap right after a notification", sentAgo(false, 0), true, false, cooldown},
+		{"change at the end of the cooldown", sentAgo(true, cooldown), false, true, 0},
+		{"change after the cooldown", sentAgo(false, time.Hour), true, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			send, wait := holdBack(tt.last, tt.online, now, cooldown)
+			if send != tt.send || wait != tt.wait {
+				t.Errorf("holdBack = %v, %s, want %v, %s", send, wait, tt.send, tt.wait)
+			}
+		})
+	}
+
+	if send, wait := holdBack(sentAgo(true, time.Second), false, now, 0); !send || wait != 0 {
+		t.Errorf("holdBack without a cooldown = %v, %s, want the change sent", send, wait)
+	}
+}
@@ -0,0 +1,397 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eblancof/telegram-bot/internal/device"
+	"github.com/eblancof/telegram-bot/internal/hub"
+	"github.com/eblancof/telegram-bot/internal/power"
+	"github.com/eblancof/telegram-bot/internal/remote"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// powerVerbs describes each power action in prompts and results.
+var powerVerbs = map[string]struct{ verb, progress string }{
+	remote.ActionShutdown: {"shut down", "Shutting down"},
+	remote.ActionReboot:   {"reboot", "Rebooting"},
+	remote.ActionSleep:    {"put to sleep", "Suspending"},
+	cmdCycle:              {"power cycle", "Power cycling"},
+}
+
+// sendPowerMessage lets the user pick a device to run action on.
+func sendPowerMessage(bot *tgbotapi.BotAPI, chatID int64, action string) {
+	var buttons [][]tgbotapi.InlineKeyboardButton
+	for _, dev := range device.Devices {
+		if canPower(dev, action) {
+			button := tgbotapi.NewInlineKeyboardButtonData(dev.Name, fmt.Sprintf("%s:%s:%s", cmdPower, action, dev.Name))
+			buttons = append(buttons, []tgbotapi.InlineKeyboardButton{button})
+		}
+	}
+	if len(buttons) == 0 {
+		text := "No device has SSH access configured or a companion agent connected. Use /modify to set up SSH."
+		if action == cmdCycle {
+			text = "No device has a power backend that can power cycle it. Use /modify to set one up."
+		}
+		bot.Send(tgbotapi.NewMessage(chatID, text))
+		return
+	}
+
+	buttons = append(buttons, []tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardButtonData("❌ Cancel", cmdCancel),
+	})
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Select a device to %s:", powerVerbs[action].verb))
+	msg.ReplyMarkup = tgbotapi.InlineKeyboardMarkup{InlineKeyboard: buttons}
+	sent, _ := bot.Send(msg)
+	if sent.MessageID != 0 {
+		addButtonMessage(chatID, sent.MessageID)
+	}
+}
+
+// sendPowerConfirm asks the user to confirm running action on deviceName.
+func sendPowerConfirm(bot *tgbotapi.BotAPI, chatID int64, action, deviceName string) {
+	text := fmt.Sprintf("Really %s %s?", powerVerbs[action].verb, deviceName)
+	for _, dev := range device.Devices {
+		if dev.Name != deviceName {
+			continue
+		}
+		if powerRoute(dev, action) == routeBackend && dev.IsPlug() {
+			text += fmt.Sprintf("\n\n⚠️ This cuts the power of %s without shutting it down.", deviceName)
+		}
+		if warning := readinessWarning(dev); action != remote.ActionReboot && action != cmdCycle && dev.WakesWithWoL() && warning != "" {
+			text += "\n\n" + warning + "\nIt may not wake up with a magic packet afterwards."
+		}
+	}
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ Yes, "+powerVerbs[action].verb,
+				fmt.Sprintf("%s:%s:%s", cmdPowerConfirm, action, deviceName)),
+			tgbotapi.NewInlineKeyboardButtonData("❌ Cancel", cmdCancel),
+		),
+	)
+	sent, _ := bot.Send(msg)
+	if sent.MessageID != 0 {
+		addButtonMessage(chatID, sent.MessageID)
+	}
+}
+
+// readinessWarning explains why dev would not wake up from a magic packet,
+// according to its last wolcheck report. It is empty when dev looks
+// wakeable or never reported.
+func readinessWarning(dev device.Computer) string {
+	r, ok := hub.GetReadiness(dev.Name)
+	switch {
+	case !ok:
+		return ""
+	case r.Error != "":
+		return fmt.Sprintf("⚠️ Wake-on-LAN state of %s unknown: %s (reported %s ago)", r.Interface, r.Error, humanDuration(time.Since(r.Received)))
+	case !r.Armed:
+		return fmt.Sprintf("⚠️ Wake-on-LAN is not armed on %s (reported %s ago)", r.Interface, humanDuration(time.Since(r.Received)))
+	case !strings.EqualFold(r.MAC, dev.MAC.String()):
+		return fmt.Sprintf("⚠️ Wake-on-LAN is armed on %s, but its MAC %s differs from %s", r.Interface, r.MAC, dev.MAC)
+	}
+	return ""
+}
+
+// backendActions maps power commands to the power backend actions that
+// carry them out.
+var backendActions = map[string]string{
+	remote.ActionShutdown: power.ActionOff,
+	remote.ActionReboot:   power.ActionReboot,
+	cmdCycle:              power.ActionCycle,
+}
+
+// Routes a power command can take to a device.
+const (
+	routeAgent   = "agent"
+	routeSSH     = "ssh"
+	routeBackend = "backend"
+)
+
+// powerRoute returns how action is run on dev: through its companion agent,
+// over SSH when none is connected, or else through its power backend. It is
+// empty when action cannot be run on dev.
+func powerRoute(dev device.Computer, action string) string {
+	if a, ok := hub.Get(dev.Name); ok && a.Alive() && a.Supports(action) {
+		return routeAgent
+	}
+	if _, ok := remote.DefaultCommands[action]; ok && dev.HasSSH() {
+		return routeSSH
+	}
+	if backendAction, ok := backendActions[action]; ok && dev.PowerBackend != "" {
+		if c, err := power.New(dev); err == nil && c.Supports(backendAction) {
+			return routeBackend
+		}
+	}
+	return ""
+}
+
+// canPower reports whether action can be run on dev.
+func canPower(dev device.Computer, action string) bool {
+	return powerRoute(dev, action) != ""
+}
+
+// runPowerAction runs action on dev along its powerRoute and reports the
+// outcome by editing a progress message.
+func runPowerAction(bot *tgbotapi.BotAPI, chatID int64, action string, dev device.Computer) {
+	reply, err := bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("%s %s…", powerVerbs[action].progress, dev.Name)))
+	if err != nil {
+		return
+	}
+
+	go func() {
+		var output string
+		var err error
+		text := fmt.Sprintf("✅ %s command ran on %s", action, dev.Name)
+		switch powerRoute(dev, action) {
+		case routeAgent:
+			output, err = requestFromAgent(dev, action)
+		case routeBackend:
+			timeout := powerTimeout
+			if action == cmdCycle {
+				timeout += power.CycleDelay
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			err = power.Set(ctx, dev, backendActions[action])
+			cancel()
+			text = fmt.Sprintf("✅ %s of %s requested via %s", action, dev.Name, dev.PowerBackend)
+		default:
+			output, err = remote.Run(context.Background(), dev, action)
+		}
+		if err != nil {
+			text = fmt.Sprintf("Failed to %s %s: %v", powerVerbs[action].verb, dev.Name, err)
+		}
+		if output != "" {
+			text += "\n\n" + truncate(output, 1000)
+		}
+		bot.Send(tgbotapi.NewEditMessageText(chatID, reply.MessageID, text))
+	}()
+}
+
+// agentTimeout bounds how long a power command waits for the agent to pick
+// it up and report back.
+const agentTimeout = time.Minute
+
+func requestFromAgent(dev device.Computer, action string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), agentTimeout)
+	defer cancel()
+	result, err := hub.Request(ctx, dev.Name, action)
+	if err != nil {
+		return "", err
+	}
+	if !result.OK {
+		return result.Output, errors.New("agent reported a failure")
+	}
+	return result.Output, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "…"
+}
+
+func startModifySSH(bot *tgbotapi.BotAPI, chatID int64, deviceName string) {
+	modifyDeviceStates[chatID] = &ModifyDeviceState{
+		DeviceName: deviceName,
+		Field:      "ssh",
+	}
+	sendCancelPrompt(bot, chatID, fmt.Sprintf(
+		"Enter SSH access for %s as USER@HOST[:PORT] followed by its host key, e.g.\n"+
+			"admin@192.168.1.10 ssh-ed25519 AAAAC3Nza…\n"+
+			"(print the key with ssh-keyscan -t ed25519 HOST), or send - to disable:", deviceName))
+}
+
+func startModifyPowerCommands(bot *tgbotapi.BotAPI, chatID int64, deviceName string) {
+	modifyDeviceStates[chatID] = &ModifyDeviceState{
+		DeviceName: deviceName,
+		Field:      "power",
+	}
+	sendCancelPrompt(bot, chatID, fmt.Sprintf(
+		"Enter the commands run on %s, one per line as ACTION: COMMAND, e.g.\n"+
+			"shutdown: sudo shutdown -h now\nsleep: sudo pm-suspend\n"+
+			"Actions are shutdown, reboot and sleep. Send - to use the defaults.", deviceName))
+}
+
+// applySSH parses "USER@HOST[:PORT] KEYTYPE KEY" or "-" into the SSH fields
+// of dev.
+func applySSH(dev *device.Computer, text string) error {
+	if strings.TrimSpace(text) == clearValue {
+		dev.SSHUser, dev.SSHHost, dev.SSHPort, dev.SSHHostKey = "", "", 0, ""
+		return nil
+	}
+
+	target, key, ok := strings.Cut(strings.TrimSpace(text), " ")
+	if !ok {
+		return fmt.Errorf("missing host key")
+	}
+	user, hostPort, ok := strings.Cut(target, "@")
+	if !ok || user == "" || hostPort == "" {
+		return fmt.Errorf("invalid SSH target %q", target)
+	}
+	host, port := hostPort, 0
+	if h, p, err := net.SplitHostPort(hostPort); err == nil {
+		n, err := strconv.Atoi(p)
+		if err != nil || n <= 0 || n > 65535 {
+			return fmt.Errorf("invalid port %q", p)
+		}
+		host, port = h, n
+	}
+	hostKey, err := remote.ParseHostKey(key)
+	if err != nil {
+		return err
+	}
+
+	dev.SSHUser, dev.SSHPort, dev.SSHHostKey = user, port, hostKey
+	dev.SSHHost = host
+	if host == dev.Host {
+		dev.SSHHost = ""
+	}
+	return nil
+}
+
+// applyPowerCommands parses "ACTION: COMMAND" lines or "-" into the power
+// commands of dev.
+func applyPowerCommands(dev *device.Computer, text string) error {
+	if strings.TrimSpace(text) == clearValue {
+		dev.ShutdownCommand, dev.RebootCommand, dev.SleepCommand = "", "", ""
+		return nil
+	}
+
+	commands := make(map[string]string)
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		action, command, ok := strings.Cut(line, ":")
+		action, command = strings.ToLower(strings.TrimSpace(action)), strings.TrimSpace(command)
+		if _, known := powerVerbs[action]; !ok || !known || command == "" {
+			return fmt.Errorf("invalid command line %q", line)
+		}
+		commands[action] = command
+	}
+
+	for action, command := range commands {
+		switch action {
+		case remote.ActionShutdown:
+			dev.ShutdownCommand = command
+		case remote.ActionReboot:
+			dev.RebootCommand = command
+		case remote.ActionSleep:
+			dev.SleepCommand = command
+		}
+	}
+	return nil
+}
+
+// formatSSH describes how dev is reached over SSH.
+func formatSSH(dev device.Computer) string {
+	target := dev.SSHUser + "@" + dev.SSHTargetHost()
+	if dev.SSHPort != 0 {
+		target = dev.SSHUser + "@" + net.JoinHostPort(dev.SSHTargetHost(), strconv.Itoa(dev.SSHPort))
+	}
+	keyType, _, _ := strings.Cut(dev.SSHHostKey, " ")
+	return fmt.Sprintf("%s (%s host key pinned)", target, keyType)
+}
+
+func startModifyBackend(bot *tgbotapi.BotAPI, chatID int64, deviceName string) {
+	modifyDeviceStates[chatID] = &ModifyDeviceState{
+		DeviceName: deviceName,
+		Field:      "backend",
+	}
+	sendCancelPrompt(bot, chatID, fmt.Sprintf(
+		"Enter the power backend of %s as KIND URL [USER PASSWORD], adding insecure for a self-signed certificate, e.g.\n"+
+			"redfish https://10.0.0.5 admin secret insecure\n"+
+			"tasmota http://192.168.1.50\n"+
+			"shelly http://192.168.1.51 admin secret\n"+
+			"A Redfish URL may point to a specific system (https://10.0.0.5/redfish/v1/Systems/1). Send - to remove it.", deviceName))
+}
+
+// applyBackend parses "KIND URL [USER PASSWORD] [insecure]" or "-" into the
+// power backend fields of dev.
+func applyBackend(dev *device.Computer, text string) error {
+	fields := strings.Fields(text)
+	if len(fields) == 1 && fields[0] == clearValue {
+		dev.PowerBackend, dev.PowerURL, dev.PowerUser, dev.PowerPassword = "", "", "", ""
+		dev.PowerInsecure, dev.WakeMethod = false, ""
+		return nil
+	}
+	insecure := len(fields) > 0 && fields[len(fields)-1] == "insecure"
+	if insecure {
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) != 2 && len(fields) != 4 {
+		return fmt.Errorf("expected KIND URL [USER PASSWORD] [insecure]")
+	}
+
+	candidate := *dev
+	candidate.PowerBackend = strings.ToLower(fields[0])
+	candidate.PowerURL, candidate.PowerUser, candidate.PowerPassword = fields[1], "", ""
+	if len(fields) == 4 {
+		candidate.PowerUser, candidate.PowerPassword = fields[2], fields[3]
+	}
+	candidate.PowerInsecure = insecure
+	if _, err := power.New(candidate); err != nil {
+		return err
+	}
+	*dev = candidate
+	return nil
+}
+
+// formatBackend describes the power backend of dev without its password.
+func formatBackend(dev device.Computer) string {
+	text := fmt.Sprintf("%s %s", dev.PowerBackend, dev.PowerURL)
+	if dev.PowerUser != "" {
+		text += " as " + dev.PowerUser
+	}
+	switch {
+	case dev.WakesWithWoL() && dev.WakesWithPower():
+		text += ", wakes with WoL and power on"
+	case dev.WakesWithPower():
+		text += ", wakes with power on only"
+	default:
+		text += ", wakes with WoL only"
+	}
+	return text
+}
+
+func sendWakeMethodOptions(bot *tgbotapi.BotAPI, chatID int64, deviceName string) {
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("How should %s be woken?", deviceName))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("WoL", fmt.Sprintf("%s:%s:%s", cmdSetWakeMethod, deviceName, device.WakeWoL)),
+			tgbotapi.NewInlineKeyboardButtonData("Power on", fmt.Sprintf("%s:%s:%s", cmdSetWakeMethod, deviceName, device.WakePower)),
+			tgbotapi.NewInlineKeyboardButtonData("Both", fmt.Sprintf("%s:%s:%s", cmdSetWakeMethod, deviceName, device.WakeBoth)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("❌ Cancel", cmdCancel),
+		),
+	)
+	sent, _ := bot.Send(msg)
+	if sent.MessageID != 0 {
+		addButtonMessage(chatID, sent.MessageID)
+	}
+}
+
+func handleSetWakeMethod(bot *tgbotapi.BotAPI, chatID int64, deviceName, method string) {
+	for i, dev := range device.Devices {
+		if dev.Name == deviceName {
+			if method != device.WakeWoL && dev.PowerBackend == "" {
+				bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("%s has no power backend. Set one with Power Backend first.", deviceName)))
+				return
+			}
+			device.Devices[i].WakeMethod = method
+			device.SaveDevices()
+			bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("%s: %s", deviceName, formatBackend(device.Devices[i]))))
+			return
+		}
+	}
+	bot.Send(tgbotapi.NewMessage(chatID, "Device not found."))
+}
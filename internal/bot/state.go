@@ -1,8 +1,12 @@
 package bot
 
+import "github.com/eblancof/telegram-bot/internal/device"
+
 type AddDeviceState struct {
-	Name  string
-	Stage string
+	Name     string
+	MAC      device.MAC
+	SecureOn string
+	Stage    string
 }
 
 type ModifyDeviceState struct {
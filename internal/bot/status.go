@@ -0,0 +1,71 @@
+package bot
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/eblancof/telegram-bot/internal/device"
+	"github.com/eblancof/telegram-bot/internal/hub"
+	"github.com/eblancof/telegram-bot/internal/monitor"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	dotOnline  = "🟢"
+	dotOffline = "🔴"
+	dotUnknown = "⚪"
+)
+
+// statusDot returns the indicator for the last known state of dev.
+func statusDot(dev device.Computer) string {
+	status, ok := monitor.Get(dev.Name)
+	switch {
+	case !monitor.Watches(dev) || !ok:
+		return dotUnknown
+	case status.Online:
+		return dotOnline
+	default:
+		return dotOffline
+	}
+}
+
+func sendStatus(bot *tgbotapi.BotAPI, chatID int64) {
+	if len(device.Devices) == 0 {
+		bot.Send(tgbotapi.NewMessage(chatID, "No devices found."))
+		return
+	}
+
+	text := "Device Status:\n\n"
+	for _, dev := range device.Devices {
+		text += fmt.Sprintf("%s %s — %s\n", statusDot(dev), dev.Name, describeStatus(dev))
+	}
+	bot.Send(tgbotapi.NewMessage(chatID, text))
+}
+
+func describeStatus(dev device.Computer) string {
+	if !monitor.Watches(dev) {
+		return "no probe configured"
+	}
+	status, ok := monitor.Get(dev.Name)
+	if !ok {
+		return "not checked yet"
+	}
+
+	state := "offline"
+	if status.Online {
+		state = "online"
+	}
+	if powerState, ok := monitor.PowerState(dev.Name); ok {
+		state += fmt.Sprintf(", power %s (%s)", powerState, dev.PowerBackend)
+	}
+	if a, ok := hub.Get(dev.Name); ok {
+		if a.Alive() {
+			return fmt.Sprintf("%s, agent on %s (%s) reported %s ago", state, a.Hostname, a.OS, humanDuration(time.Since(a.LastSeen)))
+		}
+		state += fmt.Sprintf(", agent silent for %s", humanDuration(time.Since(a.LastSeen)))
+	}
+	if status.LastSeen.IsZero() {
+		return state + ", never seen"
+	}
+	return fmt.Sprintf("%s, last seen %s ago", state, humanDuration(time.Since(status.LastSeen)))
+}
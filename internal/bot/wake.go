@@ -0,0 +1,306 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eblancof/telegram-bot/internal/config"
+	"github.com/eblancof/telegram-bot/internal/device"
+	"github.com/eblancof/telegram-bot/internal/monitor"
+	"github.com/eblancof/telegram-bot/internal/power"
+	"github.com/eblancof/telegram-bot/internal/probe"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// powerTimeout bounds a power on request to a device's power backend.
+const powerTimeout = 20 * time.Second
+
+// wakeResult is what a wake of a device achieved.
+type wakeResult struct {
+	// sent is the number of magic packets sent, attempted the size of the
+	// burst.
+	sent, attempted int
+	// poweredOn is set when the power backend accepted a power on, powerErr
+	// when it failed.
+	poweredOn bool
+	powerErr  error
+}
+
+func (r wakeResult) ok() bool {
+	return r.sent > 0 || r.poweredOn
+}
+
+// wake sends magic packets to dev and powers it on through its power
+// backend, as its wake method asks. Both run at once, so a slow backend does
+// not add to a relayed burst. It may block for powerTimeout and must not be
+// called from the update loop.
+func wake(dev device.Computer) wakeResult {
+	var result wakeResult
+	var wg sync.WaitGroup
+	if dev.WakesWithPower() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), powerTimeout)
+			defer cancel()
+			result.powerErr = power.Set(ctx, dev, power.ActionOn)
+			result.poweredOn = result.powerErr == nil
+		}()
+	}
+	if dev.WakesWithWoL() {
+		result.sent, result.attempted, _ = sendWakeOnLAN(dev)
+	}
+	wg.Wait()
+	return result
+}
+
+// Wake wakes dev like the /wol command does, for triggers outside the chat.
+func Wake(dev device.Computer) error {
+	result := wake(dev)
+	if !result.ok() {
+		if result.powerErr != nil {
+			return result.powerErr
+		}
+		return fmt.Errorf("no wake signal could be sent to %s", dev.Name)
+	}
+	return nil
+}
+
+// wakeDevice wakes dev off the update loop, since a relay or power backend
+// may take a while to answer, and edits the reply with the outcome. When
+// dev has a probe, the reply is kept updated until dev is reachable or the
+// wake timeout ends. The reply carries no reply keyboard, which would make
+// it impossible to edit; refreshKeyboard shows the ⏳ label instead.
+func wakeDevice(bot *tgbotapi.BotAPI, chatID int64, dev device.Computer) {
+	wasOnline := isOnline(dev)
+	reply, err := bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Waking %s…", dev.Name)))
+	if err != nil {
+		return
+	}
+	setWaking(dev.Name, true)
+	refreshKeyboard(bot)
+
+	go func() {
+		// Boot times count from the first packet, so they include the
+		// burst, the relay round trip and powering on the plug.
+		start := time.Now()
+		result := wake(dev)
+		text := wakeResultText(dev, result)
+		if !result.ok() || !dev.HasProbe() {
+			setWaking(dev.Name, false)
+			bot.Send(tgbotapi.NewEditMessageText(chatID, reply.MessageID, text))
+			refreshKeyboard(bot)
+			return
+		}
+		bot.Send(tgbotapi.NewEditMessageText(chatID, reply.MessageID, text+"\nWaiting for it to come up…"))
+		verifyWake(bot, chatID, reply.MessageID, dev, text, wasOnline, start)
+	}()
+}
+
+// isOnline reports whether dev was last seen online by the monitor.
+func isOnline(dev device.Computer) bool {
+	status, ok := monitor.Get(dev.Name)
+	return ok && status.Online
+}
+
+// recordBootTime stores elapsed as a boot time sample of dev. Devices that
+// were up already, online before the wake or answering the first probe,
+// would only drag the average towards zero and are skipped.
+func recordBootTime(dev device.Computer, elapsed time.Duration, wasOnline, firstProbe bool) {
+	if wasOnline || firstProbe {
+		return
+	}
+	if err := device.RecordBootTime(dev.Name, elapsed); err != nil {
+		log.Printf("Failed to save boot time of %s: %v", dev.Name, err)
+	}
+}
+
+// verifyWake polls dev and edits the reply once it answers or gives up. start
+// is when the wake began.
+func verifyWake(bot *tgbotapi.BotAPI, chatID int64, messageID int, dev device.Computer, text string, wasOnline bool, start time.Time) {
+	timeout := config.GetWakeTimeout()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make(chan struct{})
+	go showBootProgress(bot, chatID, messageID, dev, text, start, done)
+	waited, err := probe.WaitUntilUp(ctx, dev, config.GetProbeInterval())
+	close(done)
+	elapsed := time.Since(start)
+
+	monitor.Confirm(dev.Name, err == nil)
+	setWaking(dev.Name, false)
+	defer refreshKeyboard(bot)
+	// WaitUntilUp probes right away and then every probe interval, so a
+	// shorter wait means the first probe answered.
+	firstProbe := waited < config.GetProbeInterval()
+	switch avg, ok := device.AverageBootTime(dev.Name); {
+	case err != nil:
+		text += fmt.Sprintf("\n%s did not respond within %s", dev.Name, humanDuration(timeout))
+	case wasOnline || firstProbe:
+		text += fmt.Sprintf("\n%s is already up", dev.Name)
+	case ok:
+		text += fmt.Sprintf("\n%s is up after %s (usually %s)", dev.Name, humanDuration(elapsed), humanDuration(avg))
+	default:
+		text += fmt.Sprintf("\n%s is up after %s", dev.Name, humanDuration(elapsed))
+	}
+	if err == nil {
+		recordBootTime(dev, elapsed, wasOnline, firstProbe)
+	}
+	bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, text))
+}
+
+// progressInterval is how often the boot progress bar is redrawn. Telegram
+// rate limits message edits, so it should not be much shorter.
+const progressInterval = 5 * time.Second
+
+// showBootProgress edits the wake reply with an estimated-time-remaining
+// progress bar, based on dev's average boot time and the wake start, until
+// done is closed.
+func showBootProgress(bot *tgbotapi.BotAPI, chatID int64, messageID int, dev device.Computer, text string, start time.Time, done <-chan struct{}) {
+	avg, ok := device.AverageBootTime(dev.Name)
+	if !ok {
+		return
+	}
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, text+"\n"+bootProgress(time.Since(start), avg)))
+		}
+	}
+}
+
+// bootProgress renders elapsed out of the expected boot time avg as a bar
+// with the estimated time remaining.
+func bootProgress(elapsed, avg time.Duration) string {
+	const width = 10
+	if elapsed >= avg {
+		return fmt.Sprintf("[%s] taking longer than usual (%s so far, usually %s)",
+			strings.Repeat("▓", width), humanDuration(elapsed), humanDuration(avg))
+	}
+	filled := int(elapsed * width / avg)
+	return fmt.Sprintf("[%s%s] %d%% · about %s left",
+		strings.Repeat("▓", filled), strings.Repeat("░", width-filled),
+		int(elapsed*100/avg), humanDuration(avg-elapsed))
+}
+
+// humanDuration formats d as "37s", "2m15s" or "3 min".
+func humanDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	if d >= time.Minute && d%time.Minute == 0 {
+		return fmt.Sprintf("%d min", d/time.Minute)
+	}
+	return d.String()
+}
+
+var (
+	wakeLoopsMu sync.Mutex
+	// wakeLoops cancels running wake-until-up loops by progress message ID.
+	wakeLoops = make(map[int]context.CancelFunc)
+)
+
+// wakeUntilUp resends magic packets to dev until its probe succeeds or the
+// retry timeout ends, editing a single progress message with a cancel button.
+func wakeUntilUp(bot *tgbotapi.BotAPI, chatID int64, dev device.Computer) {
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("🔁 Waking %s until it is up…", dev.Name))
+	msg.ReplyMarkup = stopWakeKeyboard()
+	progress, err := bot.Send(msg)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetRetryTimeout())
+	wakeLoopsMu.Lock()
+	wakeLoops[progress.MessageID] = cancel
+	wakeLoopsMu.Unlock()
+
+	setWaking(dev.Name, true)
+	go func() {
+		defer func() {
+			wakeLoopsMu.Lock()
+			delete(wakeLoops, progress.MessageID)
+			wakeLoopsMu.Unlock()
+			cancel()
+			setWaking(dev.Name, false)
+			refreshKeyboard(bot)
+		}()
+		runWakeLoop(ctx, bot, chatID, progress.MessageID, dev)
+	}()
+}
+
+func runWakeLoop(ctx context.Context, bot *tgbotapi.BotAPI, chatID int64, messageID int, dev device.Computer) {
+	wasOnline := isOnline(dev)
+	// Taken before the first resend, as in wakeDevice.
+	start := time.Now()
+	var attempts, packets int
+	resend := func() {
+		result := wake(dev)
+		attempts++
+		packets += result.sent
+		text := fmt.Sprintf("🔁 Waking %s until it is up\nAttempt %d, %d packet(s) sent, %s elapsed (gives up after %s)",
+			dev.Name, attempts, packets, humanDuration(time.Since(start)), humanDuration(config.GetRetryTimeout()))
+		bot.Send(tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, text, stopWakeKeyboard()))
+	}
+
+	resendTicker := time.NewTicker(config.GetRetryInterval())
+	defer resendTicker.Stop()
+	probeTicker := time.NewTicker(config.GetProbeInterval())
+	defer probeTicker.Stop()
+
+	resend()
+	for probes := 1; ; probes++ {
+		if probe.Check(ctx, dev) == nil {
+			monitor.Confirm(dev.Name, true)
+			recordBootTime(dev, time.Since(start), wasOnline, probes == 1)
+			bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, fmt.Sprintf("%s %s is up after %s (%d attempt(s))",
+				dotOnline, dev.Name, humanDuration(time.Since(start)), attempts)))
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			text := fmt.Sprintf("Stopped waking %s after %s (%d attempt(s))", dev.Name, humanDuration(time.Since(start)), attempts)
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				monitor.Confirm(dev.Name, false)
+				text = fmt.Sprintf("%s %s did not respond within %s (%d attempt(s))",
+					dotOffline, dev.Name, humanDuration(config.GetRetryTimeout()), attempts)
+			}
+			bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, text))
+			return
+		case <-resendTicker.C:
+			resend()
+		case <-probeTicker.C:
+		}
+	}
+}
+
+func stopWakeLoop(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery) {
+	wakeLoopsMu.Lock()
+	cancel, ok := wakeLoops[query.Message.MessageID]
+	wakeLoopsMu.Unlock()
+
+	if ok {
+		cancel()
+		bot.Request(tgbotapi.NewCallback(query.ID, "Stopping…"))
+		return
+	}
+	bot.Request(tgbotapi.NewCallback(query.ID, "Already finished"))
+}
+
+func stopWakeKeyboard() tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("❌ Cancel", cmdStopWake),
+		),
+	)
+}
@@ -1,20 +1,89 @@
 package config
 
 import (
+	"log"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/eblancof/telegram-bot/internal/netif"
 	"github.com/joho/godotenv"
 )
 
+// fallbackBroadcastIP is used when BROADCAST_IP is unset and no interface
+// broadcast address can be detected.
+const fallbackBroadcastIP = "255.255.255.255"
+
+// MaxPacketCount and MaxBurstDuration bound a magic packet burst, so a
+// single wake never keeps its sender busy for long.
+const (
+	MaxPacketCount   = 20
+	MaxBurstDuration = 5 * time.Second
+)
+
+// BurstFits reports whether count packets sent interval apart stay within
+// MaxPacketCount and MaxBurstDuration.
+func BurstFits(count int, interval time.Duration) bool {
+	return count >= 1 && count <= MaxPacketCount && time.Duration(count-1)*interval <= MaxBurstDuration
+}
+
+// ProxyRoute forwards TCP connections accepted on Listen to Port on the
+// probe host of the named device, waking it first when needed.
+type ProxyRoute struct {
+	Listen string
+	Device string
+	Port   int
+}
+
 type Config struct {
 	BotToken    string
 	ChatID      int64
 	BroadcastIP string
-	Port        int
-	DataFile    string
+	// DetectedBroadcasts holds the interface broadcast addresses derived
+	// when BROADCAST_IP is unset.
+	DetectedBroadcasts []netif.InterfaceAddr
+	Port               int
+	// PacketCount and PacketInterval set the default magic packet burst.
+	PacketCount    int
+	PacketInterval time.Duration
+	// WakeTimeout is how long a woken device is probed before giving up,
+	// ProbeInterval the pause between probes.
+	WakeTimeout   time.Duration
+	ProbeInterval time.Duration
+	// MonitorInterval is how often every device is probed in the background.
+	MonitorInterval time.Duration
+	// NotifyThreshold is how many consecutive probes must agree before a
+	// device changes state, NotifyCooldown the minimum time between two
+	// notifications about the same device.
+	NotifyThreshold int
+	NotifyCooldown  time.Duration
+	// RetryInterval is how often wake-until-up mode resends magic packets,
+	// RetryTimeout when it gives up.
+	RetryInterval time.Duration
+	RetryTimeout  time.Duration
+	// SSHKeyFile is the private key used to power devices off over SSH.
+	SSHKeyFile string
+	// AgentListen is the address the companion agent hub listens on (empty
+	// disables it), AgentSecret the token agents authenticate with and
+	// AgentTLSCert/AgentTLSKey the optional certificate it serves.
+	AgentListen  string
+	AgentSecret  string
+	AgentTLSCert string
+	AgentTLSKey  string
+	// WakeProxy lists the wake-on-connect proxy routes.
+	WakeProxy []ProxyRoute
+	// DNSListen is the UDP address of the wake-on-lookup DNS responder
+	// (empty disables it), DNSNames maps the hostnames it answers to device
+	// names and DNSCooldown limits wakes per device.
+	DNSListen     string
+	DNSNames      map[string]string
+	DNSCooldown   time.Duration
+	DataFile      string
+	BootTimesFile string
 }
 
 var (
@@ -38,17 +107,167 @@ func Load() *Config {
 		}
 
 		chatID, _ := strconv.ParseInt(os.Getenv("CHAT_ID"), 10, 64)
+		port, err := strconv.Atoi(os.Getenv("WOL_PORT"))
+		if err != nil || port <= 0 || port > 65535 {
+			port = 9
+		}
+		packetCount, err := strconv.Atoi(os.Getenv("WOL_PACKET_COUNT"))
+		if err != nil || packetCount < 1 {
+			packetCount = 1
+		}
+		packetInterval, err := time.ParseDuration(os.Getenv("WOL_PACKET_INTERVAL"))
+		if err != nil || packetInterval < 0 {
+			packetInterval = 100 * time.Millisecond
+		}
+		if !BurstFits(packetCount, packetInterval) {
+			packetCount = MaxPacketCount
+			if packetInterval > 0 && int(MaxBurstDuration/packetInterval)+1 < packetCount {
+				packetCount = int(MaxBurstDuration/packetInterval) + 1
+			}
+			log.Printf("WOL_PACKET_COUNT and WOL_PACKET_INTERVAL exceed a %s burst of %d packets, sending %d",
+				MaxBurstDuration, MaxPacketCount, packetCount)
+		}
+		wakeTimeout, err := time.ParseDuration(os.Getenv("WAKE_TIMEOUT"))
+		if err != nil || wakeTimeout <= 0 {
+			wakeTimeout = 3 * time.Minute
+		}
+		probeInterval, err := time.ParseDuration(os.Getenv("PROBE_INTERVAL"))
+		if err != nil || probeInterval <= 0 {
+			probeInterval = 5 * time.Second
+		}
+		monitorInterval, err := time.ParseDuration(os.Getenv("MONITOR_INTERVAL"))
+		if err != nil || monitorInterval <= 0 {
+			monitorInterval = time.Minute
+		}
+		notifyThreshold, err := strconv.Atoi(os.Getenv("NOTIFY_THRESHOLD"))
+		if err != nil || notifyThreshold < 1 {
+			notifyThreshold = 2
+		}
+		notifyCooldown, err := time.ParseDuration(os.Getenv("NOTIFY_COOLDOWN"))
+		if err != nil || notifyCooldown < 0 {
+			notifyCooldown = 5 * time.Minute
+		}
+		retryInterval, err := time.ParseDuration(os.Getenv("RETRY_INTERVAL"))
+		if err != nil || retryInterval <= 0 {
+			retryInterval = 30 * time.Second
+		}
+		retryTimeout, err := time.ParseDuration(os.Getenv("RETRY_TIMEOUT"))
+		if err != nil || retryTimeout <= 0 {
+			retryTimeout = 10 * time.Minute
+		}
+		dnsCooldown, err := time.ParseDuration(os.Getenv("DNS_COOLDOWN"))
+		if err != nil || dnsCooldown < 0 {
+			dnsCooldown = time.Minute
+		}
 		instance = &Config{
-			BotToken:    os.Getenv("BOT_TOKEN"),
-			ChatID:      chatID,
-			BroadcastIP: os.Getenv("BROADCAST_IP"),
-			Port:        9,
-			DataFile:    "devices.json",
+			BotToken:        os.Getenv("BOT_TOKEN"),
+			ChatID:          chatID,
+			BroadcastIP:     os.Getenv("BROADCAST_IP"),
+			Port:            port,
+			PacketCount:     packetCount,
+			PacketInterval:  packetInterval,
+			WakeTimeout:     wakeTimeout,
+			ProbeInterval:   probeInterval,
+			MonitorInterval: monitorInterval,
+			NotifyThreshold: notifyThreshold,
+			NotifyCooldown:  notifyCooldown,
+			RetryInterval:   retryInterval,
+			RetryTimeout:    retryTimeout,
+			SSHKeyFile:      os.Getenv("SSH_KEY_FILE"),
+			AgentListen:     os.Getenv("AGENT_LISTEN"),
+			AgentSecret:     os.Getenv("AGENT_SECRET"),
+			AgentTLSCert:    os.Getenv("AGENT_TLS_CERT"),
+			AgentTLSKey:     os.Getenv("AGENT_TLS_KEY"),
+			WakeProxy:       parseProxyRoutes(os.Getenv("WAKE_PROXY")),
+			DNSListen:       os.Getenv("DNS_LISTEN"),
+			DNSNames:        parseDNSNames(os.Getenv("DNS_NAMES")),
+			DNSCooldown:     dnsCooldown,
+			DataFile:        "devices.json",
+			BootTimesFile:   "boot_times.json",
+		}
+		if instance.BroadcastIP == "" {
+			detectBroadcasts(instance)
 		}
 	})
 	return instance
 }
 
+func detectBroadcasts(cfg *Config) {
+	addrs, err := netif.InterfaceAddrs()
+	if err != nil || len(addrs) == 0 {
+		log.Printf("BROADCAST_IP not set and no interface broadcast address found, using %s", fallbackBroadcastIP)
+		cfg.BroadcastIP = fallbackBroadcastIP
+		return
+	}
+
+	cfg.DetectedBroadcasts = addrs
+	cfg.BroadcastIP = addrs[0].Broadcast.String()
+	for _, addr := range addrs {
+		log.Printf("BROADCAST_IP not set, detected %s on %s (%s)", addr.Broadcast, addr.Name, addr.IP)
+	}
+	if len(addrs) > 1 {
+		log.Printf("Devices without a target address will be woken on all %d interfaces", len(addrs))
+	}
+}
+
+// parseProxyRoutes parses comma separated LISTEN=DEVICE:PORT routes, such
+// as "3389=Desktop:3389,:2222=NAS:22". A bare port listens on all
+// addresses. Invalid routes are logged and skipped.
+func parseProxyRoutes(s string) []ProxyRoute {
+	var routes []ProxyRoute
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		listen, target, ok := strings.Cut(entry, "=")
+		i := strings.LastIndex(target, ":")
+		if !ok || i <= 0 {
+			log.Printf("Ignoring invalid WAKE_PROXY route %q", entry)
+			continue
+		}
+		if !validPort(target[i+1:]) {
+			log.Printf("Ignoring invalid WAKE_PROXY route %q", entry)
+			continue
+		}
+		port, _ := strconv.Atoi(target[i+1:])
+		if !strings.Contains(listen, ":") {
+			listen = ":" + listen
+		}
+		if _, listenPort, err := net.SplitHostPort(listen); err != nil || !validPort(listenPort) {
+			log.Printf("Ignoring invalid WAKE_PROXY route %q", entry)
+			continue
+		}
+		routes = append(routes, ProxyRoute{Listen: listen, Device: target[:i], Port: port})
+	}
+	return routes
+}
+
+// validPort reports whether s is a port number from 1 to 65535.
+func validPort(s string) bool {
+	port, err := strconv.Atoi(s)
+	return err == nil && port > 0 && port <= 65535
+}
+
+// parseDNSNames parses comma separated HOSTNAME=DEVICE pairs, such as
+// "nas.lan=NAS,desktop.lan=Desktop". Hostnames are case insensitive.
+func parseDNSNames(s string) map[string]string {
+	names := make(map[string]string)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, dev, ok := strings.Cut(entry, "=")
+		if !ok || host == "" || dev == "" {
+			log.Printf("Ignoring invalid DNS_NAMES entry %q", entry)
+			continue
+		}
+		names[strings.ToLower(strings.TrimSuffix(host, "."))] = dev
+	}
+	return names
+}
+
 // Getters
 func GetChatID() int64 {
 	return Load().ChatID
@@ -58,14 +277,94 @@ func GetBroadcastIP() string {
 	return Load().BroadcastIP
 }
 
+func GetDetectedBroadcasts() []netif.InterfaceAddr {
+	return Load().DetectedBroadcasts
+}
+
 func GetPort() int {
 	return Load().Port
 }
 
+func GetPacketCount() int {
+	return Load().PacketCount
+}
+
+func GetPacketInterval() time.Duration {
+	return Load().PacketInterval
+}
+
+func GetWakeTimeout() time.Duration {
+	return Load().WakeTimeout
+}
+
+func GetProbeInterval() time.Duration {
+	return Load().ProbeInterval
+}
+
+func GetMonitorInterval() time.Duration {
+	return Load().MonitorInterval
+}
+
+func GetNotifyThreshold() int {
+	return Load().NotifyThreshold
+}
+
+func GetNotifyCooldown() time.Duration {
+	return Load().NotifyCooldown
+}
+
+func GetRetryInterval() time.Duration {
+	return Load().RetryInterval
+}
+
+func GetRetryTimeout() time.Duration {
+	return Load().RetryTimeout
+}
+
+func GetSSHKeyFile() string {
+	return Load().SSHKeyFile
+}
+
+func GetAgentListen() string {
+	return Load().AgentListen
+}
+
+func GetAgentSecret() string {
+	return Load().AgentSecret
+}
+
+func GetAgentTLSCert() string {
+	return Load().AgentTLSCert
+}
+
+func GetAgentTLSKey() string {
+	return Load().AgentTLSKey
+}
+
+func GetWakeProxy() []ProxyRoute {
+	return Load().WakeProxy
+}
+
+func GetDNSListen() string {
+	return Load().DNSListen
+}
+
+func GetDNSNames() map[string]string {
+	return Load().DNSNames
+}
+
+func GetDNSCooldown() time.Duration {
+	return Load().DNSCooldown
+}
+
 func GetDataFile() string {
 	return Load().DataFile
 }
 
+func GetBootTimesFile() string {
+	return Load().BootTimesFile
+}
+
 func GetBotToken() string {
 	return Load().BotToken
 }
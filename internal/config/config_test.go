@@ -0,0 +1,73 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDNSNames(t *testing.T) {
+	tests := []struct {
+		in   string
+		want map[string]string
+	}{
+		{"", map[string]string{}},
+		{"nas.lan=NAS", map[string]string{"nas.lan": "NAS"}},
+		{
+			" NAS.lan.=NAS , desktop.lan=My Desktop,",
+			map[string]string{"nas.lan": "NAS", "desktop.lan": "My Desktop"},
+		},
+		{
+			"nas.lan, =NAS, printer.lan=, tv.lan=TV",
+			map[string]string{"tv.lan": "TV"},
+		},
+		{
+			"nas.lan=Old,nas.lan=New",
+			map[string]string{"nas.lan": "New"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := parseDNSNames(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseDNSNames(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseProxyRoutes(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []ProxyRoute
+	}{
+		{"", nil},
+		{"3389=Desktop:3389", []ProxyRoute{{Listen: ":3389", Device: "Desktop", Port: 3389}}},
+		{
+			" 3389=Desktop:3389 , :2222=NAS:22,",
+			[]ProxyRoute{
+				{Listen: ":3389", Device: "Desktop", Port: 3389},
+				{Listen: ":2222", Device: "NAS", Port: 22},
+			},
+		},
+		{
+			"127.0.0.1:8080=Media Server:80,[::1]:2222=NAS:22",
+			[]ProxyRoute{
+				{Listen: "127.0.0.1:8080", Device: "Media Server", Port: 80},
+				{Listen: "[::1]:2222", Device: "NAS", Port: 22},
+			},
+		},
+		// Only the last colon separates the port from the device name.
+		{"5900=VM:host:5900", []ProxyRoute{{Listen: ":5900", Device: "VM:host", Port: 5900}}},
+		{
+			"3389, 3389=Desktop, 3389=:3389, 3389=Desktop:0, 3389=Desktop:65536, 3389=Desktop:rdp, 2222=NAS:22",
+			[]ProxyRoute{{Listen: ":2222", Device: "NAS", Port: 22}},
+		},
+		{"=NAS:22, ssh=NAS:22, 0=NAS:22, 70000=NAS:22, 10.0.0.1=NAS:22", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := parseProxyRoutes(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseProxyRoutes(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package device
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/eblancof/telegram-bot/internal/config"
+)
+
+// bootSamples is how many boot times are kept per device for the average.
+const bootSamples = 5
+
+// minBootTime is the shortest plausible boot. Shorter samples, recorded for
+// devices that were up already, are left out of the average.
+const minBootTime = time.Second
+
+var (
+	bootTimesMu sync.Mutex
+	// bootTimes holds the most recent boot times per device name. It is kept
+	// apart from Devices because wake checks record them from other goroutines.
+	bootTimes = make(map[string][]time.Duration)
+)
+
+// LoadBootTimes reads the recorded boot times from disk.
+func LoadBootTimes() error {
+	file, err := os.ReadFile(config.GetBootTimesFile())
+	if err != nil {
+		return err
+	}
+	bootTimesMu.Lock()
+	defer bootTimesMu.Unlock()
+	return json.Unmarshal(file, &bootTimes)
+}
+
+func saveBootTimesLocked() error {
+	data, err := json.MarshalIndent(bootTimes, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(config.GetBootTimesFile(), data, 0644)
+}
+
+// RecordBootTime adds how long the named device took from magic packet to
+// reachable, keeping only the latest samples.
+func RecordBootTime(name string, d time.Duration) error {
+	bootTimesMu.Lock()
+	defer bootTimesMu.Unlock()
+	samples := append(bootTimes[name], d)
+	if len(samples) > bootSamples {
+		samples = samples[len(samples)-bootSamples:]
+	}
+	bootTimes[name] = samples
+	return saveBootTimesLocked()
+}
+
+// AverageBootTime returns the rolling average boot time of the named device
+// and false when none was recorded yet.
+func AverageBootTime(name string) (time.Duration, bool) {
+	bootTimesMu.Lock()
+	defer bootTimesMu.Unlock()
+	var total time.Duration
+	var n int
+	for _, d := range bootTimes[name] {
+		if d >= minBootTime {
+			total += d
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return total / time.Duration(n), true
+}
+
+// RenameBootTimes moves the boot times recorded for oldName to newName.
+func RenameBootTimes(oldName, newName string) error {
+	bootTimesMu.Lock()
+	defer bootTimesMu.Unlock()
+	samples, ok := bootTimes[oldName]
+	if !ok || oldName == newName {
+		return nil
+	}
+	delete(bootTimes, oldName)
+	bootTimes[newName] = samples
+	return saveBootTimesLocked()
+}
+
+// ForgetBootTimes drops the boot times recorded for name.
+func ForgetBootTimes(name string) error {
+	bootTimesMu.Lock()
+	defer bootTimesMu.Unlock()
+	if _, ok := bootTimes[name]; !ok {
+		return nil
+	}
+	delete(bootTimes, name)
+	return saveBootTimesLocked()
+}
@@ -1,8 +1,200 @@
 package device
 
+import (
+	"sync"
+	"time"
+
+	"github.com/eblancof/telegram-bot/internal/config"
+)
+
+const (
+	// BackendRedfish controls power through the Redfish API of a BMC.
+	BackendRedfish = "redfish"
+	// BackendTasmota and BackendShelly switch a smart plug, for machines
+	// that power on when AC power returns.
+	BackendTasmota = "tasmota"
+	BackendShelly  = "shelly"
+
+	// WakeWoL, WakePower and WakeBoth choose whether a wake sends magic
+	// packets, powers on through the power backend or does both.
+	WakeWoL   = "wol"
+	WakePower = "power"
+	WakeBoth  = "both"
+)
+
 type Computer struct {
-	Name string `json:"name"`
-	MAC  string `json:"mac"`
+	Name     string `json:"name"`
+	MAC      MAC    `json:"mac"`
+	SecureOn string `json:"secureon,omitempty"`
+	// Address and Port override the global broadcast address and port.
+	Address string `json:"address,omitempty"`
+	Port    int    `json:"port,omitempty"`
+	// Transport selects how magic packets are sent (udp or ethernet).
+	Transport string `json:"transport,omitempty"`
+	// Interface, Source and AllInterfaces choose the network interface or
+	// local address packets leave from.
+	Interface     string `json:"interface,omitempty"`
+	Source        string `json:"source,omitempty"`
+	AllInterfaces bool   `json:"all_interfaces,omitempty"`
+	// PacketCount and PacketIntervalMs override the global packet burst.
+	PacketCount      int `json:"packet_count,omitempty"`
+	PacketIntervalMs int `json:"packet_interval_ms,omitempty"`
+	// Host is the IP address or hostname used to check whether the device
+	// is up, with Probe (icmp, tcp or http), ProbePort and ProbeURL
+	// describing how.
+	Host      string `json:"host,omitempty"`
+	Probe     string `json:"probe,omitempty"`
+	ProbePort int    `json:"probe_port,omitempty"`
+	ProbeURL  string `json:"probe_url,omitempty"`
+	// Relay names the relay agent that sends magic packets for c on its LAN.
+	// Address and Interface then refer to the relay's network.
+	Relay string `json:"relay,omitempty"`
+	// Notify opts in to online/offline notifications.
+	Notify bool `json:"notify,omitempty"`
+	// SSHUser, SSHHost (Host when empty) and SSHPort are used to power the
+	// device off remotely. SSHHostKey pins the expected host key.
+	SSHUser    string `json:"ssh_user,omitempty"`
+	SSHHost    string `json:"ssh_host,omitempty"`
+	SSHPort    int    `json:"ssh_port,omitempty"`
+	SSHHostKey string `json:"ssh_host_key,omitempty"`
+	// ShutdownCommand, RebootCommand and SleepCommand override the commands
+	// run over SSH.
+	ShutdownCommand string `json:"shutdown_command,omitempty"`
+	RebootCommand   string `json:"reboot_command,omitempty"`
+	SleepCommand    string `json:"sleep_command,omitempty"`
+	// PowerBackend (redfish, tasmota or shelly) controls power at PowerURL with
+	// PowerUser and PowerPassword. PowerInsecure skips TLS verification for
+	// self-signed certificates.
+	PowerBackend  string `json:"power_backend,omitempty"`
+	PowerURL      string `json:"power_url,omitempty"`
+	PowerUser     string `json:"power_user,omitempty"`
+	PowerPassword string `json:"power_password,omitempty"`
+	PowerInsecure bool   `json:"power_insecure,omitempty"`
+	// WakeMethod is WakeWoL, WakePower or WakeBoth. When empty, devices with
+	// a smart plug are only powered on and other power backends use both.
+	WakeMethod string `json:"wake_method,omitempty"`
 }
 
+// Devices is owned by the bot's update loop. Other goroutines use All.
 var Devices []Computer
+
+var (
+	snapshotMu sync.RWMutex
+	snapshot   []Computer
+)
+
+// All returns a copy of Devices as of the last load or save. Unlike Devices
+// it is safe to use from any goroutine.
+func All() []Computer {
+	snapshotMu.RLock()
+	defer snapshotMu.RUnlock()
+	return append([]Computer(nil), snapshot...)
+}
+
+// publish makes the current Devices visible to All.
+func publish() {
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+	snapshot = append([]Computer(nil), Devices...)
+}
+
+// TargetAddress returns the address magic packets for c are sent to.
+func (c Computer) TargetAddress() string {
+	if c.Address != "" {
+		return c.Address
+	}
+	return config.GetBroadcastIP()
+}
+
+// UsesAllInterfaces reports whether magic packets for c go out on every
+// interface, either by choice or because several broadcast addresses were
+// detected and c has no explicit target.
+func (c Computer) UsesAllInterfaces() bool {
+	if c.AllInterfaces {
+		return true
+	}
+	return c.Address == "" && c.Interface == "" && c.Source == "" &&
+		len(config.GetDetectedBroadcasts()) > 1
+}
+
+// TargetPort returns the UDP port magic packets for c are sent to.
+func (c Computer) TargetPort() int {
+	if c.Port != 0 {
+		return c.Port
+	}
+	return config.GetPort()
+}
+
+// HasProbe reports whether c can be checked for reachability.
+func (c Computer) HasProbe() bool {
+	if c.Probe == "http" {
+		return c.ProbeURL != ""
+	}
+	return c.Probe != "" && c.Host != ""
+}
+
+// SSHTargetHost returns the host SSH connects to for c.
+func (c Computer) SSHTargetHost() string {
+	if c.SSHHost != "" {
+		return c.SSHHost
+	}
+	return c.Host
+}
+
+// SSHTargetPort returns the port SSH connects to for c.
+func (c Computer) SSHTargetPort() int {
+	if c.SSHPort != 0 {
+		return c.SSHPort
+	}
+	return 22
+}
+
+// HasSSH reports whether c can be powered off over SSH.
+func (c Computer) HasSSH() bool {
+	return c.SSHUser != "" && c.SSHTargetHost() != "" && c.SSHHostKey != ""
+}
+
+// IsPlug reports whether the power backend of c is a smart plug.
+func (c Computer) IsPlug() bool {
+	return c.PowerBackend == BackendTasmota || c.PowerBackend == BackendShelly
+}
+
+// wakeMethod returns the effective WakeMethod of c.
+func (c Computer) wakeMethod() string {
+	switch {
+	case c.PowerBackend == "":
+		return WakeWoL
+	case c.WakeMethod != "":
+		return c.WakeMethod
+	case c.IsPlug():
+		return WakePower
+	}
+	return WakeBoth
+}
+
+// WakesWithWoL reports whether waking c sends magic packets.
+func (c Computer) WakesWithWoL() bool {
+	return c.wakeMethod() != WakePower
+}
+
+// WakesWithPower reports whether waking c powers it on through its power
+// backend.
+func (c Computer) WakesWithPower() bool {
+	return c.wakeMethod() != WakeWoL
+}
+
+// BurstCount returns how many magic packets are sent per wake for c.
+func (c Computer) BurstCount() int {
+	if c.PacketCount > 0 {
+		return c.PacketCount
+	}
+	return config.GetPacketCount()
+}
+
+// BurstInterval returns the pause between the packets of a burst for c.
+func (c Computer) BurstInterval() time.Duration {
+	if c.PacketIntervalMs > 0 {
+		return time.Duration(c.PacketIntervalMs) * time.Millisecond
+	}
+	return config.GetPacketInterval()
+}
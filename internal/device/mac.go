@@ -0,0 +1,94 @@
+package device
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+var (
+	ErrInvalidMAC = errors.New("invalid MAC address")
+	ErrGroupMAC   = errors.New("multicast and broadcast MAC addresses cannot be woken")
+)
+
+// MAC is a unicast EUI-48 hardware address.
+type MAC [6]byte
+
+// ParseMAC parses a MAC address written with colons (AA:BB:CC:DD:EE:FF),
+// dashes (AA-BB-CC-DD-EE-FF), Cisco dotted groups (aabb.ccdd.eeff) or as
+// 12 bare hex digits. Multicast, broadcast and all-zero addresses are
+// rejected since no NIC can be woken with them.
+func ParseMAC(s string) (MAC, error) {
+	var mac MAC
+	s = strings.TrimSpace(s)
+
+	var digits string
+	switch {
+	case strings.Count(s, ":") == 5:
+		digits = joinGroups(strings.Split(s, ":"), 2)
+	case strings.Count(s, "-") == 5:
+		digits = joinGroups(strings.Split(s, "-"), 2)
+	case strings.Count(s, ".") == 2:
+		digits = joinGroups(strings.Split(s, "."), 4)
+	case len(s) == 12:
+		digits = s
+	}
+	if len(digits) != 12 {
+		return mac, fmt.Errorf("%w: %q", ErrInvalidMAC, s)
+	}
+
+	b, err := hex.DecodeString(digits)
+	if err != nil {
+		return mac, fmt.Errorf("%w: %q", ErrInvalidMAC, s)
+	}
+	copy(mac[:], b)
+
+	if mac[0]&0x01 != 0 {
+		return MAC{}, fmt.Errorf("%w: %s", ErrGroupMAC, mac)
+	}
+	if mac == (MAC{}) {
+		return MAC{}, fmt.Errorf("%w: %s", ErrInvalidMAC, mac)
+	}
+	return mac, nil
+}
+
+// joinGroups concatenates groups that each have exactly size hex digits.
+// It returns "" when a group has the wrong length.
+func joinGroups(groups []string, size int) string {
+	for _, g := range groups {
+		if len(g) != size {
+			return ""
+		}
+	}
+	return strings.Join(groups, "")
+}
+
+// String returns the canonical AA:BB:CC:DD:EE:FF form.
+func (m MAC) String() string {
+	return strings.ToUpper(net.HardwareAddr(m[:]).String())
+}
+
+// HardwareAddr returns m as a net.HardwareAddr.
+func (m MAC) HardwareAddr() net.HardwareAddr {
+	return net.HardwareAddr(m[:])
+}
+
+// IsZero reports whether m is unset.
+func (m MAC) IsZero() bool {
+	return m == MAC{}
+}
+
+func (m MAC) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *MAC) UnmarshalText(text []byte) error {
+	mac, err := ParseMAC(string(text))
+	if err != nil {
+		return err
+	}
+	*m = mac
+	return nil
+}
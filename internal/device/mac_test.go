@@ -0,0 +1,169 @@
+package device
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/eblancof/telegram-bot/internal/config"
+)
+
+func TestParseMAC(t *testing.T) {
+	want := MAC{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+	tests := []struct {
+		in      string
+		want    MAC
+		wantErr error
+	}{
+		{"00:1A:2B:3C:4D:5E", want, nil},
+		{"00:1a:2b:3c:4d:5e", want, nil},
+		{"00-1A-2B-3C-4D-5E", want, nil},
+		{"001a.2b3c.4d5e", want, nil},
+		{"001A2B3C4D5E", want, nil},
+		{"  00:1a:2b:3c:4d:5e\n", want, nil},
+
+		// Wrong lengths.
+		{"", MAC{}, ErrInvalidMAC},
+		{"00:1A:2B:3C:4D", MAC{}, ErrInvalidMAC},
+		{"00:1A:2B:3C:4D:5E:6F", MAC{}, ErrInvalidMAC},
+		{"001A2B3C4D", MAC{}, ErrInvalidMAC},
+		{"001A2B3C4D5E6F", MAC{}, ErrInvalidMAC},
+		{"001a.2b3c", MAC{}, ErrInvalidMAC},
+
+		// Malformed octets.
+		{"0:1A:2B:3C:4D:5E", MAC{}, ErrInvalidMAC},
+		{"000:1A:2B:3C:4D:5", MAC{}, ErrInvalidMAC},
+		{"00:1A:2B:3C:4D:5G", MAC{}, ErrInvalidMAC},
+		{"00:1A-2B:3C:4D:5E", MAC{}, ErrInvalidMAC},
+		{"01a.2b3c.4d5e0", MAC{}, ErrInvalidMAC},
+		{"00 1A 2B 3C 4D 5E", MAC{}, ErrInvalidMAC},
+		{"zz1a2b3c4d5e", MAC{}, ErrInvalidMAC},
+
+		// Addresses no NIC can be woken with.
+		{"01:00:5E:00:00:01", MAC{}, ErrGroupMAC},
+		{"33:33:00:00:00:01", MAC{}, ErrGroupMAC},
+		{"FF:FF:FF:FF:FF:FF", MAC{}, ErrGroupMAC},
+		{"00:00:00:00:00:00", MAC{}, ErrInvalidMAC},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseMAC(tt.in)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("ParseMAC(%q) error = %v, want %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMAC(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMACString(t *testing.T) {
+	mac := MAC{0xaa, 0xbb, 0xcc, 0x0d, 0x0e, 0x0f}
+	if got, want := mac.String(), "AA:BB:CC:0D:0E:0F"; got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+	if !(MAC{}).IsZero() || mac.IsZero() {
+		t.Error("IsZero is wrong")
+	}
+}
+
+func TestDevicesJSONRoundTrip(t *testing.T) {
+	// devices.json as written before MACs were parsed strictly, with the
+	// lowercase and dashed forms users typed.
+	legacy := `[
+  {"name": "Desktop", "mac": "aa:bb:cc:dd:ee:ff"},
+  {"name": "NAS", "mac": "00-11-22-33-44-55", "secureon": "01:02:03:04"}
+]`
+	var devices []Computer
+	if err := json.Unmarshal([]byte(legacy), &devices); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if len(devices) != 2 {
+		t.Fatalf("got %d devices, want 2", len(devices))
+	}
+	if want := (MAC{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}); devices[0].MAC != want {
+		t.Errorf("Desktop MAC = %s, want %s", devices[0].MAC, want)
+	}
+
+	data, err := json.Marshal(devices)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	for _, want := range []string{`"mac":"AA:BB:CC:DD:EE:FF"`, `"mac":"00:11:22:33:44:55"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Marshal = %s, missing %s", data, want)
+		}
+	}
+
+	var again []Computer
+	if err := json.Unmarshal(data, &again); err != nil {
+		t.Fatalf("Unmarshal of saved devices: %v", err)
+	}
+	for i := range devices {
+		if again[i].Name != devices[i].Name || again[i].MAC != devices[i].MAC || again[i].SecureOn != devices[i].SecureOn {
+			t.Errorf("device %d = %+v after a round trip, want %+v", i, again[i], devices[i])
+		}
+	}
+}
+
+func TestLoadDevicesKeepsInvalidMACs(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(dir)
+	defer func() { Devices, setAside = nil, nil }()
+
+	// MACs the validation before ParseMAC accepted: odd lengths, broadcast
+	// and multicast addresses.
+	legacy := `[
+  {"name": "Desktop", "mac": "aa:bb:cc:dd:ee:ff"},
+  {"name": "Odd", "mac": "aabbccddee"},
+  {"name": "Broadcast", "mac": "ff:ff:ff:ff:ff:ff"},
+  {"name": "NAS", "mac": "00-11-22-33-44-55"},
+  {"name": "Multicast", "mac": "01:00:5e:00:00:01"}
+]`
+	if err := os.WriteFile(config.GetDataFile(), []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadDevices(); err != nil {
+		t.Fatalf("LoadDevices: %v", err)
+	}
+	var names []string
+	for _, dev := range All() {
+		names = append(names, dev.Name)
+	}
+	if strings.Join(names, ",") != "Desktop,NAS" {
+		t.Errorf("loaded %v, want Desktop and NAS", names)
+	}
+
+	// Saving keeps the set aside entries.
+	Devices = append(Devices, Computer{Name: "Laptop", MAC: MAC{0x02, 0, 0, 0, 0, 1}})
+	if err := SaveDevices(); err != nil {
+		t.Fatalf("SaveDevices: %v", err)
+	}
+	data, err := os.ReadFile(config.GetDataFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"Desktop"`, `"Laptop"`, `"aabbccddee"`, `"ff:ff:ff:ff:ff:ff"`, `"01:00:5e:00:00:01"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("saved file lacks %s:\n%s", want, data)
+		}
+	}
+	if err := LoadDevices(); err != nil || len(Devices) != 3 || len(setAside) != 3 {
+		t.Errorf("reloading the saved file: %d devices, %d set aside, error %v; want 3, 3, nil", len(Devices), len(setAside), err)
+	}
+
+	// The strict parser still applies to a single device.
+	var dev Computer
+	if err := json.Unmarshal([]byte(`{"name": "PC", "mac": "ff:ff:ff:ff:ff:ff"}`), &dev); err == nil {
+		t.Error("Unmarshal accepted a broadcast MAC")
+	}
+}
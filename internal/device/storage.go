@@ -2,23 +2,64 @@ package device
 
 import (
 	"encoding/json"
+	"log"
 	"os"
 
 	"github.com/eblancof/telegram-bot/internal/config"
 )
 
+// setAside holds the entries of the data file that failed to load, such as
+// devices saved before MACs were parsed strictly. They are written back
+// unchanged so that no device is lost on an upgrade.
+var setAside []json.RawMessage
+
+// LoadDevices reads Devices from the data file. Entries that do not decode,
+// such as ones with a MAC ParseMAC rejects, are logged and set aside while
+// the rest of the file loads.
 func LoadDevices() error {
 	file, err := os.ReadFile(config.GetDataFile())
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(file, &Devices)
+	var entries []json.RawMessage
+	if err := json.Unmarshal(file, &entries); err != nil {
+		return err
+	}
+
+	Devices, setAside = make([]Computer, 0, len(entries)), nil
+	for _, entry := range entries {
+		var dev Computer
+		if err := json.Unmarshal(entry, &dev); err != nil {
+			var named struct{ Name string }
+			json.Unmarshal(entry, &named)
+			log.Printf("Skipping device %q in %s: %v. It stays in the file; fix it there or add the device again.",
+				named.Name, config.GetDataFile(), err)
+			setAside = append(setAside, entry)
+			continue
+		}
+		Devices = append(Devices, dev)
+	}
+	publish()
+	return nil
 }
 
 func SaveDevices() error {
-	data, err := json.MarshalIndent(Devices, "", "  ")
+	publish()
+	entries := make([]interface{}, 0, len(Devices)+len(setAside))
+	for _, dev := range Devices {
+		entries = append(entries, dev)
+	}
+	for _, entry := range setAside {
+		entries = append(entries, entry)
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(config.GetDataFile(), data, 0644)
+	// The file holds power backend passwords, so only the owner may read it.
+	// WriteFile keeps the mode of an existing file, hence the Chmod.
+	if err := os.WriteFile(config.GetDataFile(), data, 0600); err != nil {
+		return err
+	}
+	return os.Chmod(config.GetDataFile(), 0600)
 }
@@ -0,0 +1,214 @@
+// Package dnswake is a minimal DNS responder that answers A and AAAA
+// queries for configured device hostnames and wakes the device on lookup,
+// so any client resolving nas.lan wakes the NAS.
+package dnswake
+
+import (
+	"encoding/binary"
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eblancof/telegram-bot/internal/config"
+	"github.com/eblancof/telegram-bot/internal/device"
+)
+
+const (
+	typeA    = 1
+	typeAAAA = 28
+	classIN  = 1
+
+	rcodeFormErr = 1
+	rcodeRefused = 5
+
+	headerSize = 12
+	// answerTTL is kept short so clients look the name up again, and wake
+	// the device again, on their next connection.
+	answerTTL = 5
+)
+
+var errMalformed = errors.New("malformed DNS query")
+
+// WakeFunc wakes a device.
+type WakeFunc func(dev device.Computer) error
+
+var (
+	mu       sync.Mutex
+	lastWake = make(map[string]time.Time)
+)
+
+// Start answers DNS queries on the UDP address addr until the process
+// exits.
+func Start(addr string, wake WakeFunc) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("Wake-on-lookup DNS responder listening on %s for %d name(s)", addr, len(config.GetDNSNames()))
+
+	go func() {
+		buf := make([]byte, 512)
+		var delay time.Duration
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if errors.Is(err, net.ErrClosed) {
+				log.Printf("DNS responder stopped: %v", err)
+				return
+			}
+			if err != nil {
+				delay = retryDelay(delay)
+				log.Printf("DNS responder: %v, retrying in %s", err, delay)
+				time.Sleep(delay)
+				continue
+			}
+			delay = 0
+			if resp := handle(buf[:n], from, lookup, wake); resp != nil {
+				conn.WriteTo(resp, from)
+			}
+		}
+	}()
+	return nil
+}
+
+// retryDelay returns how long to wait before reading again after an error,
+// given the previous wait. It doubles from 100ms up to 10s, so an error that
+// persists does not turn the responder into a busy loop.
+func retryDelay(delay time.Duration) time.Duration {
+	switch {
+	case delay == 0:
+		return 100 * time.Millisecond
+	case delay >= 5*time.Second:
+		return 10 * time.Second
+	}
+	return 2 * delay
+}
+
+// handle answers a single query, finding the device for a name with
+// resolve. It returns nil for packets that are not worth a reply.
+func handle(query []byte, from net.Addr, resolve func(name string) (device.Computer, bool), wake WakeFunc) []byte {
+	if len(query) < headerSize || query[2]&0x80 != 0 {
+		return nil // too short or a response
+	}
+	name, qtype, qclass, end, err := parseQuestion(query)
+	if err != nil || binary.BigEndian.Uint16(query[4:]) != 1 {
+		return reply(query, headerSize, rcodeFormErr, nil)
+	}
+
+	dev, ok := resolve(name)
+	if !ok || qclass != classIN {
+		return reply(query, end, rcodeRefused, nil)
+	}
+	// Resolvers send HTTPS, SVCB and other lookups alongside address ones,
+	// and those should not wake anything on their own.
+	if (qtype == typeA || qtype == typeAAAA) && shouldWake(dev.Name) {
+		// A relayed or power backend wake can outlast the client's timeout,
+		// so answer first. The cooldown keeps wakes from piling up.
+		log.Printf("DNS responder: waking %s for a lookup of %s from %s", dev.Name, name, from)
+		go func() {
+			if err := wake(dev); err != nil {
+				log.Printf("DNS responder: failed to wake %s: %v", dev.Name, err)
+			}
+		}()
+	}
+
+	ip := net.ParseIP(dev.Host)
+	var rdata []byte
+	switch {
+	case ip == nil:
+	case qtype == typeA && ip.To4() != nil:
+		rdata = ip.To4()
+	case qtype == typeAAAA && ip.To4() == nil:
+		rdata = ip.To16()
+	}
+	return reply(query, end, 0, rdata)
+}
+
+// parseQuestion reads the first question of query and returns the
+// lowercase name, its type and class and where the question ends.
+func parseQuestion(query []byte) (name string, qtype, qclass uint16, end int, err error) {
+	var labels []string
+	i := headerSize
+	for {
+		if i >= len(query) {
+			return "", 0, 0, 0, errMalformed
+		}
+		n := int(query[i])
+		i++
+		if n == 0 {
+			break
+		}
+		if n > 63 || i+n > len(query) {
+			return "", 0, 0, 0, errMalformed
+		}
+		labels = append(labels, string(query[i:i+n]))
+		i += n
+	}
+	if i+4 > len(query) {
+		return "", 0, 0, 0, errMalformed
+	}
+	qtype = binary.BigEndian.Uint16(query[i:])
+	qclass = binary.BigEndian.Uint16(query[i+2:])
+	return strings.ToLower(strings.Join(labels, ".")), qtype, qclass, i + 4, nil
+}
+
+// reply builds a response echoing the header and the question ending at
+// end, with a single answer holding rdata when it is not nil.
+func reply(query []byte, end, rcode int, rdata []byte) []byte {
+	resp := make([]byte, end, end+16+len(rdata))
+	copy(resp, query[:end])
+
+	// QR and AA set, opcode and RD kept, RA clear.
+	resp[2] = 0x80 | 0x04 | query[2]&0x79
+	resp[3] = byte(rcode)
+	qdcount := uint16(1)
+	if end == headerSize {
+		qdcount = 0
+	}
+	binary.BigEndian.PutUint16(resp[4:], qdcount)
+	binary.BigEndian.PutUint16(resp[8:], 0)
+	binary.BigEndian.PutUint16(resp[10:], 0)
+	if rdata == nil {
+		binary.BigEndian.PutUint16(resp[6:], 0)
+		return resp
+	}
+
+	binary.BigEndian.PutUint16(resp[6:], 1)
+	qtype := uint16(typeA)
+	if len(rdata) == net.IPv6len {
+		qtype = typeAAAA
+	}
+	resp = append(resp, 0xc0, headerSize) // pointer to the question name
+	resp = binary.BigEndian.AppendUint16(resp, qtype)
+	resp = binary.BigEndian.AppendUint16(resp, classIN)
+	resp = binary.BigEndian.AppendUint32(resp, answerTTL)
+	resp = binary.BigEndian.AppendUint16(resp, uint16(len(rdata)))
+	return append(resp, rdata...)
+}
+
+func lookup(name string) (device.Computer, bool) {
+	devName, ok := config.GetDNSNames()[name]
+	if !ok {
+		return device.Computer{}, false
+	}
+	for _, dev := range device.All() {
+		if dev.Name == devName {
+			return dev, true
+		}
+	}
+	return device.Computer{}, false
+}
+
+// shouldWake reports whether name is out of its cooldown and records the
+// wake.
+func shouldWake(name string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	if time.Since(lastWake[name]) < config.GetDNSCooldown() {
+		return false
+	}
+	lastWake[name] = time.Now()
+	return true
+}
@@ -0,0 +1,288 @@
+package dnswake
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eblancof/telegram-bot/internal/device"
+)
+
+var testFrom = &net.UDPAddr{IP: net.IPv4(192, 168, 1, 20), Port: 53000}
+
+// question encodes name, qtype and class IN in wire format.
+func question(name string, qtype uint16) []byte {
+	var q []byte
+	for _, label := range strings.Split(name, ".") {
+		q = append(q, byte(len(label)))
+		q = append(q, label...)
+	}
+	q = append(q, 0)
+	q = binary.BigEndian.AppendUint16(q, qtype)
+	return binary.BigEndian.AppendUint16(q, classIN)
+}
+
+// query builds a recursive query with ID 0x1234 holding body, which has
+// qdcount questions and arcount additional records.
+func query(qdcount, arcount uint16, body ...byte) []byte {
+	q := []byte{0x12, 0x34, 0x01, 0x00}
+	q = binary.BigEndian.AppendUint16(q, qdcount)
+	q = binary.BigEndian.AppendUint16(q, 0)
+	q = binary.BigEndian.AppendUint16(q, 0)
+	q = binary.BigEndian.AppendUint16(q, arcount)
+	return append(q, body...)
+}
+
+// optRecord is an EDNS(0) OPT pseudo-record advertising a 4096 byte
+// payload.
+var optRecord = []byte{0, 0, 41, 0x10, 0x00, 0, 0, 0, 0, 0, 0}
+
+// fakeDevices resolves the names in hosts to devices with that host, and
+// reports the devices woken on the returned channel.
+func fakeDevices(hosts map[string]string) (func(string) (device.Computer, bool), WakeFunc, <-chan string) {
+	woken := make(chan string, 10)
+	resolve := func(name string) (device.Computer, bool) {
+		host, ok := hosts[name]
+		return device.Computer{Name: name, Host: host}, ok
+	}
+	wake := func(dev device.Computer) error {
+		woken <- dev.Name
+		return nil
+	}
+	return resolve, wake, woken
+}
+
+type header struct {
+	id                        uint16
+	flags                     uint16
+	qd, an, ns, ar            uint16
+	rcode                     int
+	qr, aa, rd, ra, truncated bool
+}
+
+func parseHeader(t *testing.T, resp []byte) header {
+	t.Helper()
+	if len(resp) < headerSize {
+		t.Fatalf("reply of %d bytes is shorter than a header", len(resp))
+	}
+	flags := binary.BigEndian.Uint16(resp[2:])
+	return header{
+		id:        binary.BigEndian.Uint16(resp),
+		flags:     flags,
+		qd:        binary.BigEndian.Uint16(resp[4:]),
+		an:        binary.BigEndian.Uint16(resp[6:]),
+		ns:        binary.BigEndian.Uint16(resp[8:]),
+		ar:        binary.BigEndian.Uint16(resp[10:]),
+		rcode:     int(flags & 0x0f),
+		qr:        flags&0x8000 != 0,
+		aa:        flags&0x0400 != 0,
+		truncated: flags&0x0200 != 0,
+		rd:        flags&0x0100 != 0,
+		ra:        flags&0x0080 != 0,
+	}
+}
+
+func TestParseQuestion(t *testing.T) {
+	q := query(1, 0, question("NAS.Lan", typeAAAA)...)
+	name, qtype, qclass, end, err := parseQuestion(q)
+	if err != nil {
+		t.Fatalf("parseQuestion: %v", err)
+	}
+	if name != "nas.lan" || qtype != typeAAAA || qclass != classIN || end != len(q) {
+		t.Errorf("parseQuestion = %q, %d, %d, %d, want nas.lan, %d, %d, %d", name, qtype, qclass, end, typeAAAA, classIN, len(q))
+	}
+}
+
+func TestHandleAnswers(t *testing.T) {
+	resolve, wake, woken := fakeDevices(map[string]string{
+		"nas.lan":     "192.168.1.10",
+		"desktop.lan": "fd00::10",
+		"laptop.lan":  "laptop.local",
+	})
+	tests := []struct {
+		name   string
+		qtype  uint16
+		rdata  []byte
+		opt    bool
+		answer bool
+	}{
+		{"nas.lan", typeA, net.ParseIP("192.168.1.10").To4(), false, true},
+		{"desktop.lan", typeAAAA, net.ParseIP("fd00::10").To16(), false, true},
+		{"NAS.LAN", typeA, net.ParseIP("192.168.1.10").To4(), true, true},
+		// Known names without an address of the asked type get an empty
+		// NOERROR reply.
+		{"nas.lan", typeAAAA, nil, false, false},
+		{"desktop.lan", typeA, nil, false, false},
+		{"laptop.lan", typeA, nil, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := question(tt.name, tt.qtype)
+			var arcount uint16
+			if tt.opt {
+				body, arcount = append(body, optRecord...), 1
+			}
+			q := query(1, arcount, body...)
+			resp := handle(q, testFrom, resolve, wake)
+
+			h := parseHeader(t, resp)
+			if h.id != 0x1234 || !h.qr || !h.aa || !h.rd || h.ra || h.truncated || h.rcode != 0 {
+				t.Errorf("header = %+v, want ID 0x1234, QR, AA and RD set, RA and TC clear, NOERROR", h)
+			}
+			if h.qd != 1 || h.ns != 0 || h.ar != 0 {
+				t.Errorf("counts = %d/%d/%d/%d, want 1 question and no authority or additional records", h.qd, h.an, h.ns, h.ar)
+			}
+			end := headerSize + len(question(tt.name, tt.qtype))
+			if !bytes.Equal(resp[headerSize:end], q[headerSize:end]) {
+				t.Errorf("question not echoed: %x", resp[headerSize:end])
+			}
+
+			if !tt.answer {
+				if h.an != 0 || len(resp) != end {
+					t.Errorf("got %d answer(s) in %x, want none", h.an, resp[end:])
+				}
+				return
+			}
+			if h.an != 1 {
+				t.Fatalf("got %d answers, want 1", h.an)
+			}
+			rr := resp[end:]
+			if len(rr) != 12+len(tt.rdata) {
+				t.Fatalf("answer record is %d bytes, want %d", len(rr), 12+len(tt.rdata))
+			}
+			if rr[0] != 0xc0 || rr[1] != headerSize {
+				t.Errorf("answer name = %x, want a pointer to the question", rr[:2])
+			}
+			if got := binary.BigEndian.Uint16(rr[2:]); got != tt.qtype {
+				t.Errorf("answer type = %d, want %d", got, tt.qtype)
+			}
+			if got := binary.BigEndian.Uint16(rr[4:]); got != classIN {
+				t.Errorf("answer class = %d, want IN", got)
+			}
+			if got := binary.BigEndian.Uint32(rr[6:]); got != answerTTL {
+				t.Errorf("TTL = %d, want %d", got, answerTTL)
+			}
+			if got := binary.BigEndian.Uint16(rr[10:]); int(got) != len(tt.rdata) {
+				t.Errorf("RDLENGTH = %d, want %d", got, len(tt.rdata))
+			}
+			if !bytes.Equal(rr[12:], tt.rdata) {
+				t.Errorf("RDATA = %x, want %x", rr[12:], tt.rdata)
+			}
+		})
+	}
+
+	// Every name was woken once, later lookups fell in the cooldown.
+	got := make(map[string]int)
+	for len(got) < 3 {
+		select {
+		case name := <-woken:
+			got[strings.ToLower(name)]++
+		case <-time.After(time.Second):
+			t.Fatalf("woken %v, want nas.lan, desktop.lan and laptop.lan", got)
+		}
+	}
+	select {
+	case name := <-woken:
+		t.Errorf("%s woken again within the cooldown", name)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestHandleRefused(t *testing.T) {
+	resolve, wake, woken := fakeDevices(map[string]string{"printer.lan": "192.168.1.30"})
+
+	chaos := question("printer.lan", typeA)
+	binary.BigEndian.PutUint16(chaos[len(chaos)-2:], 3)
+
+	for name, body := range map[string][]byte{
+		"unknown name": question("example.com", typeA),
+		"class CH":     chaos,
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp := handle(query(1, 0, body...), testFrom, resolve, wake)
+			h := parseHeader(t, resp)
+			if h.rcode != rcodeRefused || !h.qr || h.an != 0 || h.qd != 1 {
+				t.Errorf("header = %+v, want REFUSED with the question and no answer", h)
+			}
+		})
+	}
+	select {
+	case name := <-woken:
+		t.Errorf("%s woken by a refused query", name)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestHandleMalformed(t *testing.T) {
+	resolve, wake, _ := fakeDevices(map[string]string{"nas.lan": "192.168.1.10"})
+	full := question("nas.lan", typeA)
+
+	// nas.lan as a compression pointer to a name at offset 12, which real
+	// queries never use in the question.
+	pointer := []byte{0xc0, headerSize}
+	pointer = binary.BigEndian.AppendUint16(pointer, typeA)
+	pointer = binary.BigEndian.AppendUint16(pointer, classIN)
+
+	tests := []struct {
+		name  string
+		query []byte
+	}{
+		{"no question", query(0, 0)},
+		{"two questions", query(2, 0, append(full, full...)...)},
+		{"name cut short", query(1, 0, full[:5]...)},
+		{"label past the end", query(1, 0, 9, 'n', 'a', 's')},
+		{"missing root label", query(1, 0, full[:8]...)},
+		{"type and class cut short", query(1, 0, full[:len(full)-2]...)},
+		{"compression pointer", query(1, 0, pointer...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := handle(tt.query, testFrom, resolve, wake)
+			h := parseHeader(t, resp)
+			if h.rcode != rcodeFormErr || !h.qr || h.an != 0 {
+				t.Errorf("header = %+v, want FORMERR without answers", h)
+			}
+			if h.qd != 0 || len(resp) != headerSize {
+				t.Errorf("reply of %d bytes with %d question(s), want a bare header", len(resp), h.qd)
+			}
+		})
+	}
+}
+
+func TestHandleIgnored(t *testing.T) {
+	resolve, wake, _ := fakeDevices(map[string]string{"nas.lan": "192.168.1.10"})
+
+	response := query(1, 0, question("nas.lan", typeA)...)
+	response[2] |= 0x80
+
+	for name, q := range map[string][]byte{
+		"empty":            nil,
+		"truncated header": query(1, 0)[:headerSize-1],
+		"response":         response,
+	} {
+		if resp := handle(q, testFrom, resolve, wake); resp != nil {
+			t.Errorf("%s: got reply %x, want none", name, resp)
+		}
+	}
+}
+
+func TestHandleOtherTypesDoNotWake(t *testing.T) {
+	resolve, wake, woken := fakeDevices(map[string]string{"tv.lan": "192.168.1.40"})
+
+	// MX, TXT, SVCB, HTTPS and ANY.
+	for _, qtype := range []uint16{15, 16, 64, 65, 255} {
+		resp := handle(query(1, 0, question("tv.lan", qtype)...), testFrom, resolve, wake)
+		h := parseHeader(t, resp)
+		if h.rcode != 0 || h.an != 0 || h.qd != 1 {
+			t.Errorf("type %d: header = %+v, want an empty NOERROR reply", qtype, h)
+		}
+	}
+	select {
+	case name := <-woken:
+		t.Errorf("%s woken by a lookup of another type", name)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,109 @@
+package hub
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eblancof/telegram-bot/internal/agent"
+	"github.com/eblancof/telegram-bot/internal/device"
+)
+
+// Pending is an enrollment waiting for the admin's approval.
+type Pending struct {
+	ID string
+	agent.Enrollment
+	MAC      device.MAC
+	Received time.Time
+}
+
+var (
+	enrollMu sync.Mutex
+	// tokens maps unused enrollment tokens to when they expire.
+	tokens    = make(map[string]time.Time)
+	pending   = make(map[string]Pending)
+	enrollFns []func(Pending)
+)
+
+// IssueToken returns a new enrollment token that can be used once within
+// ttl.
+func IssueToken(ttl time.Duration) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	enrollMu.Lock()
+	defer enrollMu.Unlock()
+	now := time.Now()
+	for t, expires := range tokens {
+		if now.After(expires) {
+			delete(tokens, t)
+		}
+	}
+	tokens[token] = now.Add(ttl)
+	return token
+}
+
+// OnEnroll registers fn to be called when a machine asks to be enrolled.
+func OnEnroll(fn func(Pending)) {
+	enrollMu.Lock()
+	defer enrollMu.Unlock()
+	enrollFns = append(enrollFns, fn)
+}
+
+// TakeEnrollment removes and returns the pending enrollment with id, so it
+// is approved or rejected only once.
+func TakeEnrollment(id string) (Pending, bool) {
+	enrollMu.Lock()
+	defer enrollMu.Unlock()
+	p, ok := pending[id]
+	delete(pending, id)
+	return p, ok
+}
+
+// redeemToken consumes the enrollment token r is authenticated with.
+func redeemToken(r *http.Request) bool {
+	token, ok := agent.BearerToken(r)
+	if !ok {
+		return false
+	}
+	enrollMu.Lock()
+	defer enrollMu.Unlock()
+	expires, ok := tokens[token]
+	delete(tokens, token)
+	return ok && time.Now().Before(expires)
+}
+
+func handleEnroll(w http.ResponseWriter, r *http.Request) {
+	var e agent.Enrollment
+	if !decode(w, r, redeemToken, &e) {
+		return
+	}
+	mac, err := device.ParseMAC(e.MAC)
+	if err == nil && net.ParseIP(e.IP) == nil {
+		err = errors.New("invalid IP address")
+	}
+	if err == nil && strings.TrimSpace(e.Hostname) == "" {
+		err = errors.New("missing hostname")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p := Pending{ID: newID(), Enrollment: e, MAC: mac, Received: time.Now()}
+	enrollMu.Lock()
+	pending[p.ID] = p
+	notify := enrollFns
+	enrollMu.Unlock()
+
+	for _, fn := range notify {
+		fn(p)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,193 @@
+// Package hub is the server side of the companion agent protocol. It
+// tracks agent heartbeats and hands queued power commands to agents.
+package hub
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/eblancof/telegram-bot/internal/agent"
+	"github.com/eblancof/telegram-bot/internal/config"
+)
+
+// missedHeartbeats is how many heartbeats an agent may miss before it is no
+// longer considered alive.
+const missedHeartbeats = 3
+
+var (
+	ErrNoAgent     = errors.New("no agent connected for device")
+	ErrUnsupported = errors.New("agent does not support action")
+)
+
+// Agent is what is known about a connected agent.
+type Agent struct {
+	agent.Heartbeat
+	LastSeen time.Time
+}
+
+// Alive reports whether a heartbeat from a is still expected to be recent.
+func (a Agent) Alive() bool {
+	interval := a.Interval
+	if interval < time.Second {
+		interval = time.Second
+	}
+	return time.Since(a.LastSeen) < missedHeartbeats*interval
+}
+
+// Supports reports whether a can perform action.
+func (a Agent) Supports(action string) bool {
+	for _, supported := range a.Actions {
+		if supported == action {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	mu      sync.Mutex
+	agents  = make(map[string]Agent)
+	queued  = make(map[string][]agent.Command)
+	waiting = make(map[string]chan agent.Result)
+)
+
+// Start serves the agent protocol on addr, using TLS when a certificate is
+// configured.
+func Start(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(agent.HeartbeatPath, handleHeartbeat)
+	mux.HandleFunc(agent.ResultPath, handleResult)
+	mux.HandleFunc(agent.EnrollPath, handleEnroll)
+	mux.HandleFunc(agent.WoLPath, handleWoL)
+	mux.HandleFunc(agent.RelayPollPath, handleRelayPoll)
+	mux.HandleFunc(agent.RelayResultPath, handleRelayResult)
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		var err error
+		if cert, key := config.GetAgentTLSCert(), config.GetAgentTLSKey(); cert != "" {
+			log.Printf("Agent hub listening on %s (TLS)", addr)
+			err = server.ListenAndServeTLS(cert, key)
+		} else {
+			log.Printf("Agent hub listening on %s without TLS, use AGENT_TLS_CERT outside trusted networks", addr)
+			err = server.ListenAndServe()
+		}
+		log.Printf("Agent hub stopped: %v", err)
+	}()
+}
+
+// Get returns the agent reporting for the named device. ok is false when no
+// heartbeat was received since the server started.
+func Get(name string) (a Agent, ok bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	a, ok = agents[name]
+	return a, ok
+}
+
+// Request queues action for the agent of the named device and waits for it
+// to report the outcome.
+func Request(ctx context.Context, name, action string) (agent.Result, error) {
+	a, ok := Get(name)
+	if !ok || !a.Alive() {
+		return agent.Result{}, ErrNoAgent
+	}
+	if !a.Supports(action) {
+		return agent.Result{}, ErrUnsupported
+	}
+
+	id := newID()
+	done := make(chan agent.Result, 1)
+	mu.Lock()
+	queued[name] = append(queued[name], agent.Command{ID: id, Action: action})
+	waiting[id] = done
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		delete(waiting, id)
+		mu.Unlock()
+	}()
+
+	select {
+	case result := <-done:
+		return result, nil
+	case <-ctx.Done():
+		mu.Lock()
+		commands := queued[name][:0]
+		for _, c := range queued[name] {
+			if c.ID != id {
+				commands = append(commands, c)
+			}
+		}
+		queued[name] = commands
+		mu.Unlock()
+		return agent.Result{}, ctx.Err()
+	}
+}
+
+func handleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	var hb agent.Heartbeat
+	if !decode(w, r, agentAuthorized, &hb) {
+		return
+	}
+
+	mu.Lock()
+	agents[hb.Name] = Agent{Heartbeat: hb, LastSeen: time.Now()}
+	resp := agent.HeartbeatResponse{Commands: queued[hb.Name]}
+	delete(queued, hb.Name)
+	mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func handleResult(w http.ResponseWriter, r *http.Request) {
+	var result agent.Result
+	if !decode(w, r, agentAuthorized, &result) {
+		return
+	}
+
+	mu.Lock()
+	done, ok := waiting[result.ID]
+	delete(waiting, result.ID)
+	mu.Unlock()
+	if ok {
+		done <- result
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func agentAuthorized(r *http.Request) bool {
+	return agent.Authorized(r, config.GetAgentSecret())
+}
+
+// decode authenticates r and reads its JSON body into v, replying with an
+// error and returning false when either fails.
+func decode(w http.ResponseWriter, r *http.Request, authorized func(*http.Request) bool, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if !authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(v); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
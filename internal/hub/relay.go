@@ -0,0 +1,153 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/eblancof/telegram-bot/internal/agent"
+)
+
+var ErrNoRelay = errors.New("relay is not connected")
+
+// relay is the state of a relay agent on a remote LAN.
+type relay struct {
+	lastSeen time.Time
+	// polling counts the polls currently held open by the relay.
+	polling int
+	queue   []agent.WakeRequest
+	// wake is signalled when a request is queued.
+	wake chan struct{}
+}
+
+// RelayInfo describes a relay for display.
+type RelayInfo struct {
+	Name      string
+	LastSeen  time.Time
+	Connected bool
+}
+
+var (
+	relayMu      sync.Mutex
+	relays       = make(map[string]*relay)
+	relayWaiting = make(map[string]chan agent.WakeResult)
+)
+
+func (r *relay) connected() bool {
+	return r.polling > 0 || time.Since(r.lastSeen) < 2*agent.RelayPollTimeout
+}
+
+// Relays lists the relays that polled since the server started.
+func Relays() []RelayInfo {
+	relayMu.Lock()
+	defer relayMu.Unlock()
+	infos := make([]RelayInfo, 0, len(relays))
+	for name, r := range relays {
+		infos = append(infos, RelayInfo{Name: name, LastSeen: r.lastSeen, Connected: r.connected()})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// Wake asks the named relay to send req on its LAN and waits for the result.
+func Wake(ctx context.Context, name string, req agent.WakeRequest) (agent.WakeResult, error) {
+	req.ID = newID()
+	done := make(chan agent.WakeResult, 1)
+
+	relayMu.Lock()
+	r, ok := relays[name]
+	if !ok || !r.connected() {
+		relayMu.Unlock()
+		return agent.WakeResult{}, ErrNoRelay
+	}
+	r.queue = append(r.queue, req)
+	relayWaiting[req.ID] = done
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+	relayMu.Unlock()
+
+	defer func() {
+		relayMu.Lock()
+		delete(relayWaiting, req.ID)
+		relayMu.Unlock()
+	}()
+
+	select {
+	case result := <-done:
+		if result.Error != "" {
+			return result, errors.New(result.Error)
+		}
+		return result, nil
+	case <-ctx.Done():
+		relayMu.Lock()
+		queue := r.queue[:0]
+		for _, q := range r.queue {
+			if q.ID != req.ID {
+				queue = append(queue, q)
+			}
+		}
+		r.queue = queue
+		relayMu.Unlock()
+		return agent.WakeResult{}, ctx.Err()
+	}
+}
+
+func handleRelayPoll(w http.ResponseWriter, req *http.Request) {
+	var poll agent.RelayPoll
+	if !decode(w, req, agentAuthorized, &poll) {
+		return
+	}
+
+	relayMu.Lock()
+	r, ok := relays[poll.Name]
+	if !ok {
+		r = &relay{wake: make(chan struct{}, 1)}
+		relays[poll.Name] = r
+	}
+	r.lastSeen = time.Now()
+	r.polling++
+	empty := len(r.queue) == 0
+	relayMu.Unlock()
+
+	if empty {
+		timer := time.NewTimer(agent.RelayPollTimeout)
+		select {
+		case <-r.wake:
+		case <-timer.C:
+		case <-req.Context().Done():
+		}
+		timer.Stop()
+	}
+
+	relayMu.Lock()
+	r.lastSeen = time.Now()
+	r.polling--
+	resp := agent.RelayPollResponse{Requests: r.queue}
+	r.queue = nil
+	relayMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func handleRelayResult(w http.ResponseWriter, r *http.Request) {
+	var result agent.WakeResult
+	if !decode(w, r, agentAuthorized, &result) {
+		return
+	}
+
+	relayMu.Lock()
+	done, ok := relayWaiting[result.ID]
+	delete(relayWaiting, result.ID)
+	relayMu.Unlock()
+	if ok {
+		done <- result
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
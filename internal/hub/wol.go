@@ -0,0 +1,41 @@
+package hub
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/eblancof/telegram-bot/internal/agent"
+)
+
+// Readiness is the last Wake-on-LAN report received for a device.
+type Readiness struct {
+	agent.WoLReport
+	Received time.Time
+}
+
+var (
+	readinessMu sync.Mutex
+	readiness   = make(map[string]Readiness)
+)
+
+// GetReadiness returns the last Wake-on-LAN report for the named device. ok
+// is false when none was received since the server started.
+func GetReadiness(name string) (r Readiness, ok bool) {
+	readinessMu.Lock()
+	defer readinessMu.Unlock()
+	r, ok = readiness[name]
+	return r, ok
+}
+
+func handleWoL(w http.ResponseWriter, r *http.Request) {
+	var report agent.WoLReport
+	if !decode(w, r, agentAuthorized, &report) {
+		return
+	}
+
+	readinessMu.Lock()
+	readiness[report.Name] = Readiness{WoLReport: report, Received: time.Now()}
+	readinessMu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,212 @@
+// Package monitor periodically probes every device that has a probe
+// configured, a companion agent connected or a power backend and keeps
+// track of which ones are online.
+package monitor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/eblancof/telegram-bot/internal/config"
+	"github.com/eblancof/telegram-bot/internal/device"
+	"github.com/eblancof/telegram-bot/internal/hub"
+	"github.com/eblancof/telegram-bot/internal/power"
+	"github.com/eblancof/telegram-bot/internal/probe"
+)
+
+// Status is the last known reachability of a device. Online only flips
+// after config.GetNotifyThreshold consecutive probes agree, so a single
+// lost probe does not mark a device offline, or when Confirm sets it.
+type Status struct {
+	Online    bool
+	LastSeen  time.Time
+	LastCheck time.Time
+	// Since is when Online last changed.
+	Since time.Time
+
+	// disagreeing counts consecutive probes that contradict Online.
+	disagreeing int
+}
+
+// ChangeFunc is called when the Online state of a device flips.
+type ChangeFunc func(name string, status Status)
+
+var (
+	mu       sync.RWMutex
+	statuses = make(map[string]Status)
+	// powerStates holds the state last read from each power backend.
+	powerStates = make(map[string]power.State)
+	listeners   []ChangeFunc
+	rounds      []func()
+)
+
+// Start probes all devices every interval until ctx is cancelled.
+func Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			checkAll(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// OnChange registers fn to be called whenever a device goes online or
+// offline. The first observation of a device is not reported as a change.
+func OnChange(fn ChangeFunc) {
+	mu.Lock()
+	defer mu.Unlock()
+	listeners = append(listeners, fn)
+}
+
+// OnRound registers fn to be called after every round of probes.
+func OnRound(fn func()) {
+	mu.Lock()
+	defer mu.Unlock()
+	rounds = append(rounds, fn)
+}
+
+// Watches reports whether the state of dev is tracked, through its probe,
+// its companion agent or its power backend.
+func Watches(dev device.Computer) bool {
+	_, hasAgent := hub.Get(dev.Name)
+	return dev.HasProbe() || hasAgent || dev.PowerBackend != ""
+}
+
+// PowerState returns the power state last read from the power backend of
+// the named device.
+func PowerState(name string) (state power.State, ok bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	state, ok = powerStates[name]
+	return state, ok
+}
+
+// Get returns the status of the named device. ok is false until the device
+// has been probed at least once.
+func Get(name string) (status Status, ok bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	status, ok = statuses[name]
+	return status, ok
+}
+
+// Record stores the outcome of a single probe, which changes the state of
+// the named device once enough consecutive probes agree.
+func Record(name string, online bool) {
+	record(name, online, false)
+}
+
+// Confirm sets the state of the named device right away, for outcomes that
+// were already checked repeatedly, such as waiting for a device to come up
+// after a wake.
+func Confirm(name string, online bool) {
+	record(name, online, true)
+}
+
+func record(name string, online, confirmed bool) {
+	mu.Lock()
+	now := time.Now()
+	status, seen := statuses[name]
+	status.LastCheck = now
+	if online {
+		status.LastSeen = now
+	}
+
+	changed := false
+	switch {
+	case !seen:
+		status.Online, status.Since = online, now
+	case online == status.Online:
+		status.disagreeing = 0
+	default:
+		status.disagreeing++
+		if confirmed || status.disagreeing >= config.GetNotifyThreshold() {
+			status.Online, status.Since, status.disagreeing = online, now, 0
+			changed = true
+		}
+	}
+	statuses[name] = status
+	notify := listeners
+	mu.Unlock()
+
+	if changed {
+		for _, fn := range notify {
+			fn(name, status)
+		}
+	}
+}
+
+func checkAll(ctx context.Context) {
+	devices := device.All()
+	known := make(map[string]bool, len(devices))
+
+	var wg sync.WaitGroup
+	for _, dev := range devices {
+		if !Watches(dev) {
+			continue
+		}
+		known[dev.Name] = true
+		wg.Add(1)
+		go func(dev device.Computer) {
+			defer wg.Done()
+			check(ctx, dev)
+		}(dev)
+	}
+	wg.Wait()
+
+	// Forget devices that were deleted, renamed or lost their probe.
+	mu.Lock()
+	for name := range statuses {
+		if !known[name] {
+			delete(statuses, name)
+		}
+	}
+	for name := range powerStates {
+		if !known[name] {
+			delete(powerStates, name)
+		}
+	}
+	notify := rounds
+	mu.Unlock()
+
+	for _, fn := range notify {
+		fn()
+	}
+}
+
+// check records the state of dev. A live agent is authoritative. Once it
+// stops sending heartbeats the probe decides, and without one the power
+// state read from the power backend.
+func check(ctx context.Context, dev device.Computer) {
+	var state power.State
+	if dev.PowerBackend != "" {
+		var err error
+		state, err = power.Get(ctx, dev)
+		mu.Lock()
+		if err != nil {
+			delete(powerStates, dev.Name)
+		} else {
+			powerStates[dev.Name] = state
+		}
+		mu.Unlock()
+	}
+
+	a, hasAgent := hub.Get(dev.Name)
+	switch {
+	case hasAgent && a.Alive():
+		Record(dev.Name, true)
+	case dev.HasProbe():
+		Record(dev.Name, probe.Check(ctx, dev) == nil)
+	case hasAgent:
+		Record(dev.Name, false)
+	case state != "":
+		Record(dev.Name, state == power.StateOn)
+	}
+}
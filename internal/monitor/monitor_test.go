@@ -0,0 +1,85 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/eblancof/telegram-bot/internal/config"
+)
+
+func TestRecordThreshold(t *testing.T) {
+	t.Setenv("NOTIFY_THRESHOLD", "3")
+	if got := config.GetNotifyThreshold(); got != 3 {
+		t.Skipf("NOTIFY_THRESHOLD is %d, want 3", got)
+	}
+
+	const name = "threshold"
+	var changes []bool
+	OnChange(func(changed string, status Status) {
+		if changed == name {
+			changes = append(changes, status.Online)
+		}
+	})
+
+	tests := []struct {
+		online  bool
+		want    bool
+		changed bool
+	}{
+		// The first probe sets the state without reporting a change.
+		{true, true, false},
+		// Two lost probes stay below the threshold, a good one resets it.
+		{false, true, false},
+		{false, true, false},
+		{true, true, false},
+		{false, true, false},
+		{false, true, false},
+		{false, false, true},
+		{false, false, false},
+		{true, false, false},
+		{true, false, false},
+		{true, true, true},
+	}
+	for i, tt := range tests {
+		before := len(changes)
+		Record(name, tt.online)
+		status, ok := Get(name)
+		if !ok || status.Online != tt.want {
+			t.Fatalf("probe %d (online %v): Online = %v, want %v", i, tt.online, status.Online, tt.want)
+		}
+		if changed := len(changes) > before; changed != tt.changed {
+			t.Fatalf("probe %d (online %v): change reported %v, want %v", i, tt.online, changed, tt.changed)
+		}
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	t.Setenv("NOTIFY_THRESHOLD", "3")
+	if got := config.GetNotifyThreshold(); got != 3 {
+		t.Skipf("NOTIFY_THRESHOLD is %d, want 3", got)
+	}
+
+	const name = "confirm"
+	var changes []bool
+	OnChange(func(changed string, status Status) {
+		if changed == name {
+			changes = append(changes, status.Online)
+		}
+	})
+
+	Record(name, false)
+	Record(name, true)
+	Confirm(name, true)
+	if status, _ := Get(name); !status.Online || len(changes) != 1 {
+		t.Fatalf("after a confirmed wake: Online = %v with %d change(s), want online after 1", status.Online, len(changes))
+	}
+	// The probe that disagreed before the confirmation no longer counts.
+	Record(name, false)
+	Record(name, false)
+	if status, _ := Get(name); !status.Online {
+		t.Error("two lost probes after a confirmation marked the device offline")
+	}
+	Confirm(name, true)
+	if len(changes) != 1 {
+		t.Errorf("confirming the current state reported %d change(s), want none", len(changes)-1)
+	}
+}
@@ -0,0 +1,72 @@
+// Package netif enumerates the host's IPv4 interfaces and their broadcast
+// addresses.
+package netif
+
+import (
+	"fmt"
+	"net"
+)
+
+// InterfaceAddr is an up IPv4 interface address and its broadcast address.
+type InterfaceAddr struct {
+	Name      string
+	IP        net.IP
+	Broadcast net.IP
+}
+
+// InterfaceAddrs lists the IPv4 addresses of every up, non-loopback
+// interface that supports broadcast.
+func InterfaceAddrs() ([]InterfaceAddr, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []InterfaceAddr
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagBroadcast == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+				result = append(result, newInterfaceAddr(iface.Name, ipNet))
+			}
+		}
+	}
+	return result, nil
+}
+
+// ByName returns the first IPv4 address assigned to ifaceName.
+func ByName(ifaceName string) (InterfaceAddr, error) {
+	iface, err := net.InterfaceByName(ifaceName)
+	if err != nil {
+		return InterfaceAddr{}, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return InterfaceAddr{}, err
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			return newInterfaceAddr(iface.Name, ipNet), nil
+		}
+	}
+	return InterfaceAddr{}, fmt.Errorf("interface %s has no IPv4 address", ifaceName)
+}
+
+func newInterfaceAddr(name string, ipNet *net.IPNet) InterfaceAddr {
+	ip := ipNet.IP.To4()
+	mask := net.IP(ipNet.Mask).To4()
+	if mask == nil {
+		mask = net.IP(ipNet.Mask[len(ipNet.Mask)-net.IPv4len:])
+	}
+	broadcast := make(net.IP, net.IPv4len)
+	for i := range ip {
+		broadcast[i] = ip[i] | ^mask[i]
+	}
+	return InterfaceAddr{Name: name, IP: ip, Broadcast: broadcast}
+}
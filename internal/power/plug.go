@@ -0,0 +1,346 @@
+package power
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/eblancof/telegram-bot/internal/device"
+)
+
+// CycleDelay is how long a plug stays off during a power cycle, so the
+// machine's power supply fully discharges.
+const CycleDelay = 10 * time.Second
+
+// ErrAlreadyOn is returned when powering on a plug that is on already. A
+// machine that shut itself down behind it needs a power cycle instead.
+var ErrAlreadyOn = errors.New("plug is already on, use a power cycle if the machine is off")
+
+// plugAPI switches the relay of a particular plug firmware.
+type plugAPI interface {
+	get(ctx context.Context, p *plug) (bool, error)
+	set(ctx context.Context, p *plug, on bool) error
+}
+
+// plug controls a machine that powers on when its smart plug switches on,
+// through the local HTTP API of the plug at PowerURL.
+type plug struct {
+	api      plugAPI
+	client   *http.Client
+	base     string
+	user     string
+	password string
+}
+
+func newPlug(dev device.Computer, api plugAPI) (*plug, error) {
+	u, err := url.Parse(dev.PowerURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid plug URL %q", dev.PowerURL)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if dev.PowerInsecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &plug{
+		api:      api,
+		client:   &http.Client{Timeout: 10 * time.Second, Transport: transport},
+		base:     u.Scheme + "://" + u.Host,
+		user:     dev.PowerUser,
+		password: dev.PowerPassword,
+	}, nil
+}
+
+func (p *plug) Supports(action string) bool {
+	return action == ActionOn || action == ActionOff || action == ActionCycle
+}
+
+func (p *plug) State(ctx context.Context) (State, error) {
+	on, err := p.api.get(ctx, p)
+	if err != nil {
+		return "", err
+	}
+	if on {
+		return StateOn, nil
+	}
+	return StateOff, nil
+}
+
+func (p *plug) Set(ctx context.Context, action string) error {
+	switch action {
+	case ActionOn:
+		if on, err := p.api.get(ctx, p); err != nil {
+			return err
+		} else if on {
+			return ErrAlreadyOn
+		}
+		return p.api.set(ctx, p, true)
+	case ActionOff:
+		return p.api.set(ctx, p, false)
+	case ActionCycle:
+		if err := p.api.set(ctx, p, false); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(CycleDelay):
+		}
+		return p.api.set(ctx, p, true)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupported, action)
+	}
+}
+
+// How a plug API authenticates requests.
+const (
+	// authNone sends no credentials, for APIs that take them in the query.
+	authNone = iota
+	authBasic
+	// authDigest answers the digest challenge of a 401 reply.
+	authDigest
+)
+
+// getJSON fetches path with query from the plug, authenticating as auth
+// says, and decodes the reply.
+func (p *plug) getJSON(ctx context.Context, path string, query url.Values, auth int, out interface{}) error {
+	uri := path
+	if len(query) > 0 {
+		uri += "?" + query.Encode()
+	}
+
+	resp, err := p.get(ctx, uri, auth == authBasic, "")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && auth == authDigest && p.password != "" {
+		resp.Body.Close()
+		authorization, err := p.digestAuthorization(resp.Header.Get("WWW-Authenticate"), uri)
+		if err != nil {
+			return err
+		}
+		if resp, err = p.get(ctx, uri, false, authorization); err != nil {
+			return err
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		if p.password == "" {
+			return errors.New("plug requires a user and password")
+		}
+		return errors.New("plug rejected the user or password")
+	}
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("plug replied %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (p *plug) get(ctx context.Context, uri string, basicAuth bool, authorization string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.base+uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	if basicAuth && p.user != "" {
+		req.SetBasicAuth(p.user, p.password)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	return p.client.Do(req)
+}
+
+// digestAuthorization answers an HTTP digest challenge (RFC 7616) for a GET
+// of uri. Shelly Gen2 devices use SHA-256 and the fixed user admin.
+func (p *plug) digestAuthorization(challenge, uri string) (string, error) {
+	scheme, rest, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Digest") {
+		return "", fmt.Errorf("unsupported plug authentication %q", scheme)
+	}
+
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", err
+	}
+	user := p.user
+	if user == "" {
+		user = "admin"
+	}
+	return digestResponse(parseAuthParams(rest), user, p.password, uri, hex.EncodeToString(buf[:]))
+}
+
+// digestResponse computes the Authorization header answering the digest
+// challenge params for a GET of uri, with the client nonce cnonce.
+func digestResponse(params map[string]string, user, password, uri, cnonce string) (string, error) {
+	algorithm := params["algorithm"]
+	var hash func(string) string
+	switch strings.ToUpper(algorithm) {
+	case "SHA-256":
+		hash = func(s string) string {
+			sum := sha256.Sum256([]byte(s))
+			return hex.EncodeToString(sum[:])
+		}
+	case "", "MD5":
+		hash = func(s string) string {
+			sum := md5.Sum([]byte(s))
+			return hex.EncodeToString(sum[:])
+		}
+	default:
+		return "", fmt.Errorf("unsupported digest algorithm %q", algorithm)
+	}
+
+	realm, nonce := params["realm"], params["nonce"]
+	ha1 := hash(user + ":" + realm + ":" + password)
+	ha2 := hash(http.MethodGet + ":" + uri)
+
+	header := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s"`, user, realm, nonce, uri)
+	if algorithm != "" {
+		header += ", algorithm=" + algorithm
+	}
+	if opaque, ok := params["opaque"]; ok {
+		header += fmt.Sprintf(`, opaque="%s"`, opaque)
+	}
+	if !hasToken(params["qop"], "auth") {
+		return header + fmt.Sprintf(`, response="%s"`, hash(ha1+":"+nonce+":"+ha2)), nil
+	}
+
+	const nc = "00000001"
+	response := hash(ha1 + ":" + nonce + ":" + nc + ":" + cnonce + ":auth:" + ha2)
+	return header + fmt.Sprintf(`, qop=auth, nc=%s, cnonce="%s", response="%s"`, nc, cnonce, response), nil
+}
+
+// parseAuthParams splits the comma separated key=value pairs of a
+// WWW-Authenticate challenge, unquoting quoted values.
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " ,")
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			return params
+		}
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				return params
+			}
+			value, s = rest[1:end+1], rest[end+2:]
+		} else {
+			value, s, _ = strings.Cut(rest, ",")
+		}
+		params[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+}
+
+// hasToken reports whether the comma separated list contains token.
+func hasToken(list, token string) bool {
+	for _, t := range strings.Split(list, ",") {
+		if strings.TrimSpace(t) == token {
+			return true
+		}
+	}
+	return false
+}
+
+// tasmota uses the Tasmota web command API.
+type tasmota struct{}
+
+func (tasmota) command(ctx context.Context, p *plug, cmnd string) (bool, error) {
+	query := url.Values{"cmnd": {cmnd}}
+	if p.user != "" {
+		query.Set("user", p.user)
+		query.Set("password", p.password)
+	}
+	var reply struct {
+		Power string `json:"POWER"`
+	}
+	if err := p.getJSON(ctx, "/cm", query, authNone, &reply); err != nil {
+		return false, err
+	}
+	switch reply.Power {
+	case "ON":
+		return true, nil
+	case "OFF":
+		return false, nil
+	}
+	return false, errors.New("unexpected Tasmota reply, is the password right?")
+}
+
+func (t tasmota) get(ctx context.Context, p *plug) (bool, error) {
+	return t.command(ctx, p, "Power")
+}
+
+func (t tasmota) set(ctx context.Context, p *plug, on bool) error {
+	cmnd := "Power Off"
+	if on {
+		cmnd = "Power On"
+	}
+	_, err := t.command(ctx, p, cmnd)
+	return err
+}
+
+// shelly uses the first relay of a Shelly plug, through the Gen1 HTTP API
+// with basic authentication or the Gen2 RPC API with digest authentication,
+// whichever the device reports.
+type shelly struct{}
+
+func (shelly) gen2(ctx context.Context, p *plug) (bool, error) {
+	var info struct {
+		Gen int `json:"gen"`
+	}
+	if err := p.getJSON(ctx, "/shelly", nil, authNone, &info); err != nil {
+		return false, err
+	}
+	return info.Gen >= 2, nil
+}
+
+func (s shelly) get(ctx context.Context, p *plug) (bool, error) {
+	gen2, err := s.gen2(ctx, p)
+	if err != nil {
+		return false, err
+	}
+	if gen2 {
+		var status struct {
+			Output bool `json:"output"`
+		}
+		err := p.getJSON(ctx, "/rpc/Switch.GetStatus", url.Values{"id": {"0"}}, authDigest, &status)
+		return status.Output, err
+	}
+	var relay struct {
+		IsOn bool `json:"ison"`
+	}
+	err = p.getJSON(ctx, "/relay/0", nil, authBasic, &relay)
+	return relay.IsOn, err
+}
+
+func (s shelly) set(ctx context.Context, p *plug, on bool) error {
+	gen2, err := s.gen2(ctx, p)
+	if err != nil {
+		return err
+	}
+	if gen2 {
+		var reply map[string]interface{}
+		return p.getJSON(ctx, "/rpc/Switch.Set", url.Values{"id": {"0"}, "on": {fmt.Sprint(on)}}, authDigest, &reply)
+	}
+	turn := "off"
+	if on {
+		turn = "on"
+	}
+	var relay struct {
+		IsOn bool `json:"ison"`
+	}
+	return p.getJSON(ctx, "/relay/0", url.Values{"turn": {turn}}, authBasic, &relay)
+}
@@ -0,0 +1,196 @@
+package power
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/eblancof/telegram-bot/internal/device"
+)
+
+func TestParseAuthParams(t *testing.T) {
+	tests := []struct {
+		in   string
+		want map[string]string
+	}{
+		{"", map[string]string{}},
+		{
+			`realm="shellyplus1-a8032ab12345", qop="auth", nonce="1700000000", algorithm=SHA-256`,
+			map[string]string{"realm": "shellyplus1-a8032ab12345", "qop": "auth", "nonce": "1700000000", "algorithm": "SHA-256"},
+		},
+		{
+			// Commas and equals signs inside quotes belong to the value.
+			`Realm="a, b=c",qop="auth, auth-int",stale=FALSE`,
+			map[string]string{"realm": "a, b=c", "qop": "auth, auth-int", "stale": "FALSE"},
+		},
+		{`nonce="unterminated`, map[string]string{}},
+		{`realm="r", junk`, map[string]string{"realm": "r"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := parseAuthParams(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseAuthParams(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDigestResponse(t *testing.T) {
+	// The example of RFC 7616 section 3.9.1.
+	challenge := func(algorithm string) map[string]string {
+		return parseAuthParams(`realm="http-auth@example.org", qop="auth, auth-int", algorithm=` + algorithm +
+			`, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`)
+	}
+	const cnonce = "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ"
+
+	tests := []struct {
+		name     string
+		params   map[string]string
+		response string
+		wantErr  bool
+	}{
+		{"RFC 7616 MD5", challenge("MD5"), "8ca523f5e9506fed4657c9700eebdbec", false},
+		{"RFC 7616 SHA-256", challenge("SHA-256"), "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1", false},
+		{"unsupported algorithm", challenge("SHA-512-256"), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, err := digestResponse(tt.params, "Mufasa", "Circle of Life", "/dir/index.html", cnonce)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("digestResponse = %q, want an error", header)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("digestResponse: %v", err)
+			}
+			scheme, rest, _ := strings.Cut(header, " ")
+			got := parseAuthParams(rest)
+			want := map[string]string{
+				"username":  "Mufasa",
+				"realm":     "http-auth@example.org",
+				"uri":       "/dir/index.html",
+				"algorithm": tt.params["algorithm"],
+				"nonce":     "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v",
+				"nc":        "00000001",
+				"cnonce":    cnonce,
+				"qop":       "auth",
+				"response":  tt.response,
+				"opaque":    "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS",
+			}
+			if scheme != "Digest" || !reflect.DeepEqual(got, want) {
+				t.Errorf("digestResponse = %s\nwant %s %v", header, "Digest", want)
+			}
+		})
+	}
+
+	t.Run("without qop", func(t *testing.T) {
+		// RFC 2069 style: response = H(HA1:nonce:HA2), no nc or cnonce.
+		params := parseAuthParams(`realm="testrealm@host.com", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093"`)
+		header, err := digestResponse(params, "Mufasa", "Circle Of Life", "/dir/index.html", cnonce)
+		if err != nil {
+			t.Fatalf("digestResponse: %v", err)
+		}
+		_, rest, _ := strings.Cut(header, " ")
+		got := parseAuthParams(rest)
+		if got["response"] != "670fd8c2df070c60b045671b8b24ff02" {
+			t.Errorf("response = %s, want 670fd8c2df070c60b045671b8b24ff02", got["response"])
+		}
+		if _, ok := got["cnonce"]; ok {
+			t.Errorf("header %s has a cnonce without qop", header)
+		}
+	})
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// shellyGen2 fakes a password protected Shelly Gen2 plug that checks the
+// digest Authorization header of every RPC call.
+type shellyGen2 struct {
+	password string
+	on       bool
+	// challenges counts the 401 replies, authorized the accepted calls.
+	challenges, authorized int
+}
+
+const (
+	gen2Realm = "shellyplugsg3-abcdef"
+	gen2Nonce = "1700000000"
+)
+
+func (s *shellyGen2) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/shelly" {
+		fmt.Fprint(w, `{"gen":3}`)
+		return
+	}
+
+	scheme, rest, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	p := parseAuthParams(rest)
+	ha1 := sha256Hex("admin:" + gen2Realm + ":" + s.password)
+	ha2 := sha256Hex(r.Method + ":" + r.URL.RequestURI())
+	want := sha256Hex(ha1 + ":" + gen2Nonce + ":" + p["nc"] + ":" + p["cnonce"] + ":auth:" + ha2)
+	if scheme != "Digest" || p["username"] != "admin" || p["realm"] != gen2Realm || p["nonce"] != gen2Nonce ||
+		p["uri"] != r.URL.RequestURI() || p["qop"] != "auth" || p["cnonce"] == "" || p["response"] != want {
+		s.challenges++
+		w.Header().Set("WWW-Authenticate", `Digest qop="auth", realm="`+gen2Realm+`", nonce="`+gen2Nonce+`", algorithm=SHA-256`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	s.authorized++
+	switch r.URL.Path {
+	case "/rpc/Switch.Set":
+		s.on = r.URL.Query().Get("on") == "true"
+		fmt.Fprint(w, `{"was_on":false}`)
+	case "/rpc/Switch.GetStatus":
+		fmt.Fprintf(w, `{"id":0,"output":%v}`, s.on)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestShellyGen2DigestAuth(t *testing.T) {
+	plug := &shellyGen2{password: "secret"}
+	srv := httptest.NewServer(plug)
+	defer srv.Close()
+	ctx := context.Background()
+
+	dev := device.Computer{PowerBackend: device.BackendShelly, PowerURL: srv.URL, PowerPassword: "secret"}
+	if err := Set(ctx, dev, ActionOn); err != nil {
+		t.Fatalf("Set on: %v", err)
+	}
+	if state, err := Get(ctx, dev); err != nil || state != StateOn {
+		t.Fatalf("Get = %q, %v, want %q", state, err, StateOn)
+	}
+	if !plug.on || plug.authorized != 3 || plug.challenges != 3 {
+		t.Errorf("plug on %v after %d authorized calls and %d challenges, want on after 3 each",
+			plug.on, plug.authorized, plug.challenges)
+	}
+
+	tests := []struct {
+		name, user, password, wantErr string
+	}{
+		{"wrong password", "admin", "guess", "rejected the user or password"},
+		{"wrong user", "root", "secret", "rejected the user or password"},
+		{"no password", "", "", "requires a user and password"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dev.PowerUser, dev.PowerPassword = tt.user, tt.password
+			_, err := Get(ctx, dev)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Get error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+// Package power controls the power of devices through out-of-band backends
+// such as a server's BMC or a smart plug, as an alternative to Wake-on-LAN.
+package power
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/eblancof/telegram-bot/internal/device"
+)
+
+const (
+	ActionOn     = "on"
+	ActionOff    = "off"
+	ActionReboot = "reboot"
+	// ActionCycle switches power off and on again.
+	ActionCycle = "cycle"
+)
+
+// State is the power state reported by a backend.
+type State string
+
+const (
+	StateOn  State = "on"
+	StateOff State = "off"
+	// StateTransition is reported while a device powers on or off.
+	StateTransition State = "changing"
+)
+
+var (
+	ErrNoBackend      = errors.New("device has no power backend")
+	ErrUnknownBackend = errors.New("unknown power backend")
+	ErrUnsupported    = errors.New("power action not supported by backend")
+)
+
+// Controller switches the power of one device.
+type Controller interface {
+	// Set performs one of the Action constants.
+	Set(ctx context.Context, action string) error
+	State(ctx context.Context) (State, error)
+	Supports(action string) bool
+}
+
+// New returns the Controller for the power backend of dev.
+func New(dev device.Computer) (Controller, error) {
+	switch dev.PowerBackend {
+	case "":
+		return nil, ErrNoBackend
+	case device.BackendRedfish:
+		return newRedfish(dev)
+	case device.BackendTasmota:
+		return newPlug(dev, tasmota{})
+	case device.BackendShelly:
+		return newPlug(dev, shelly{})
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownBackend, dev.PowerBackend)
+	}
+}
+
+// Set performs action on dev through its power backend.
+func Set(ctx context.Context, dev device.Computer, action string) error {
+	c, err := New(dev)
+	if err != nil {
+		return err
+	}
+	if !c.Supports(action) {
+		return fmt.Errorf("%w: %s", ErrUnsupported, action)
+	}
+	return c.Set(ctx, action)
+}
+
+// Get reads the power state of dev from its power backend.
+func Get(ctx context.Context, dev device.Computer) (State, error) {
+	c, err := New(dev)
+	if err != nil {
+		return "", err
+	}
+	return c.State(ctx)
+}
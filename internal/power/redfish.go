@@ -0,0 +1,163 @@
+package power
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/eblancof/telegram-bot/internal/device"
+)
+
+// systemsPath is the Redfish collection of computer systems.
+const systemsPath = "/redfish/v1/Systems"
+
+// redfishResetTypes maps actions to ComputerSystem.Reset types.
+var redfishResetTypes = map[string]string{
+	ActionOn:     "On",
+	ActionOff:    "GracefulShutdown",
+	ActionReboot: "GracefulRestart",
+	ActionCycle:  "PowerCycle",
+}
+
+// redfish controls a system through the Redfish API of its BMC. PowerURL is
+// the BMC address, optionally with the path of a specific system; without
+// one the first system is used.
+type redfish struct {
+	client   *http.Client
+	base     string
+	system   string
+	user     string
+	password string
+}
+
+func newRedfish(dev device.Computer) (*redfish, error) {
+	u, err := url.Parse(dev.PowerURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid Redfish URL %q", dev.PowerURL)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if dev.PowerInsecure {
+		// BMCs usually ship self-signed certificates.
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	r := &redfish{
+		client:   &http.Client{Timeout: 15 * time.Second, Transport: transport},
+		base:     u.Scheme + "://" + u.Host,
+		user:     dev.PowerUser,
+		password: dev.PowerPassword,
+	}
+	if strings.HasPrefix(u.Path, systemsPath+"/") {
+		r.system = strings.TrimSuffix(u.Path, "/")
+	}
+	return r, nil
+}
+
+func (r *redfish) Supports(action string) bool {
+	_, ok := redfishResetTypes[action]
+	return ok
+}
+
+func (r *redfish) State(ctx context.Context) (State, error) {
+	system, err := r.getSystem(ctx)
+	if err != nil {
+		return "", err
+	}
+	switch system.PowerState {
+	case "On":
+		return StateOn, nil
+	case "Off":
+		return StateOff, nil
+	default:
+		return StateTransition, nil
+	}
+}
+
+func (r *redfish) Set(ctx context.Context, action string) error {
+	resetType, ok := redfishResetTypes[action]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnsupported, action)
+	}
+	system, err := r.getSystem(ctx)
+	if err != nil {
+		return err
+	}
+	target := system.Actions.Reset.Target
+	if target == "" {
+		target = r.system + "/Actions/ComputerSystem.Reset"
+	}
+	return r.do(ctx, http.MethodPost, target, map[string]string{"ResetType": resetType}, nil)
+}
+
+type redfishSystem struct {
+	PowerState string `json:"PowerState"`
+	Actions    struct {
+		Reset struct {
+			Target string `json:"target"`
+		} `json:"#ComputerSystem.Reset"`
+	} `json:"Actions"`
+}
+
+func (r *redfish) getSystem(ctx context.Context) (redfishSystem, error) {
+	var system redfishSystem
+	if r.system == "" {
+		var systems struct {
+			Members []struct {
+				ID string `json:"@odata.id"`
+			} `json:"Members"`
+		}
+		if err := r.do(ctx, http.MethodGet, systemsPath, nil, &systems); err != nil {
+			return system, err
+		}
+		if len(systems.Members) == 0 {
+			return system, errors.New("BMC reports no computer systems")
+		}
+		r.system = systems.Members[0].ID
+	}
+	err := r.do(ctx, http.MethodGet, r.system, nil, &system)
+	return system, err
+}
+
+// do sends a request to path on the BMC, encoding body and decoding the
+// reply into out when they are not nil.
+func (r *redfish) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, r.base+path, reader)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(r.user, r.password)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("BMC replied %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,101 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"time"
+)
+
+const (
+	icmpEchoRequest   = 8
+	icmpEchoReply     = 0
+	icmpv6EchoRequest = 128
+	icmpv6EchoReply   = 129
+)
+
+var errNoReply = errors.New("no echo reply")
+
+// pingHost sends a single ICMP echo request to host and waits for the reply.
+// Raw ICMP sockets need CAP_NET_RAW.
+func pingHost(ctx context.Context, host string) error {
+	ip, err := resolve(ctx, host)
+	if err != nil {
+		return err
+	}
+
+	network, request, reply := "ip4:icmp", byte(icmpEchoRequest), byte(icmpEchoReply)
+	if ip.To4() == nil {
+		network, request, reply = "ip6:ipv6-icmp", icmpv6EchoRequest, icmpv6EchoReply
+	}
+
+	var d net.Dialer
+	c, err := d.DialContext(ctx, network, ip.String())
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	conn := c.(*net.IPConn)
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(attemptTimeout))
+	}
+
+	id := uint16(os.Getpid())
+	seq := uint16(time.Now().UnixNano())
+	msg := make([]byte, 16)
+	msg[0] = request
+	binary.BigEndian.PutUint16(msg[4:], id)
+	binary.BigEndian.PutUint16(msg[6:], seq)
+	copy(msg[8:], "wolprobe")
+	if ip.To4() != nil {
+		// The kernel fills in the ICMPv6 checksum itself.
+		binary.BigEndian.PutUint16(msg[2:], checksum(msg))
+	}
+
+	if _, err := conn.Write(msg); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		// ReadFrom, unlike Read, strips the IPv4 header.
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return errNoReply
+		}
+		if n >= 8 && buf[0] == reply &&
+			binary.BigEndian.Uint16(buf[4:]) == id && binary.BigEndian.Uint16(buf[6:]) == seq {
+			return nil
+		}
+	}
+}
+
+func resolve(ctx context.Context, host string) (net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip, nil
+	}
+	addrs, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	return addrs[0], nil
+}
+
+func checksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
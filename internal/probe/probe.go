@@ -0,0 +1,90 @@
+// Package probe checks whether a device is reachable.
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/eblancof/telegram-bot/internal/device"
+)
+
+const (
+	TypeICMP = "icmp"
+	TypeTCP  = "tcp"
+	TypeHTTP = "http"
+)
+
+// attemptTimeout bounds a single probe attempt.
+const attemptTimeout = 3 * time.Second
+
+var ErrNoProbe = errors.New("device has no probe configured")
+
+// Check probes dev once and returns nil when it is reachable.
+func Check(ctx context.Context, dev device.Computer) error {
+	if !dev.HasProbe() {
+		return ErrNoProbe
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, attemptTimeout)
+	defer cancel()
+
+	switch dev.Probe {
+	case TypeICMP:
+		return pingHost(ctx, dev.Host)
+	case TypeTCP:
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(dev.Host, strconv.Itoa(dev.ProbePort)))
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case TypeHTTP:
+		return checkHTTP(ctx, dev.ProbeURL)
+	default:
+		return fmt.Errorf("unknown probe type %q", dev.Probe)
+	}
+}
+
+// WaitUntilUp probes dev every interval until it responds or ctx is done,
+// and returns how long that took.
+func WaitUntilUp(ctx context.Context, dev device.Computer, interval time.Duration) (time.Duration, error) {
+	start := time.Now()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := Check(ctx, dev); err == nil {
+			return time.Since(start), nil
+		} else if errors.Is(err, ErrNoProbe) {
+			return 0, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return time.Since(start), ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func checkHTTP(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
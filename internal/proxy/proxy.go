@@ -0,0 +1,146 @@
+// Package proxy forwards TCP connections to devices, waking them with a
+// magic packet and holding the connection until the target port opens, so
+// RDP or SSH clients work against sleeping machines.
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/eblancof/telegram-bot/internal/config"
+	"github.com/eblancof/telegram-bot/internal/device"
+)
+
+const (
+	// dialTimeout bounds a single connection attempt to the device.
+	dialTimeout = 2 * time.Second
+	// dialInterval is the pause between attempts while the device boots.
+	dialInterval = 2 * time.Second
+)
+
+// WakeFunc wakes a device.
+type WakeFunc func(dev device.Computer) error
+
+var (
+	mu sync.Mutex
+	// lastWake limits magic packets to one burst per device and retry
+	// interval, however many connections are waiting.
+	lastWake = make(map[string]time.Time)
+)
+
+// Start listens on every route and forwards accepted connections, calling
+// wake for devices that do not answer.
+func Start(routes []config.ProxyRoute, wake WakeFunc) error {
+	for _, route := range routes {
+		l, err := net.Listen("tcp", route.Listen)
+		if err != nil {
+			return fmt.Errorf("wake proxy %s: %w", route.Listen, err)
+		}
+		log.Printf("Wake proxy listening on %s for %s port %d", route.Listen, route.Device, route.Port)
+		go serve(l, route, wake)
+	}
+	return nil
+}
+
+func serve(l net.Listener, route config.ProxyRoute, wake WakeFunc) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			log.Printf("Wake proxy %s: %v", route.Listen, err)
+			time.Sleep(time.Second)
+			continue
+		}
+		go forward(conn, route, wake)
+	}
+}
+
+func forward(client net.Conn, route config.ProxyRoute, wake WakeFunc) {
+	defer client.Close()
+
+	dev, ok := findDevice(route.Device)
+	if !ok || dev.Host == "" {
+		log.Printf("Wake proxy %s: device %s not found or has no host", route.Listen, route.Device)
+		return
+	}
+	addr := net.JoinHostPort(dev.Host, strconv.Itoa(route.Port))
+
+	// Anything the client sends meanwhile waits in the socket buffer.
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetWakeTimeout())
+	defer cancel()
+
+	target, err := dialUntilUp(ctx, dev, addr, client.RemoteAddr().String(), wake)
+	if err != nil {
+		log.Printf("Wake proxy %s: %s did not open %s: %v", route.Listen, dev.Name, addr, err)
+		return
+	}
+	defer target.Close()
+
+	done := make(chan struct{}, 2)
+	go pipe(target, client, done)
+	go pipe(client, target, done)
+	<-done
+	<-done
+}
+
+// dialUntilUp connects to addr, waking dev while the connection fails.
+func dialUntilUp(ctx context.Context, dev device.Computer, addr, from string, wake WakeFunc) (net.Conn, error) {
+	var d net.Dialer
+	for {
+		attemptCtx, cancel := context.WithTimeout(ctx, dialTimeout)
+		conn, err := d.DialContext(attemptCtx, "tcp", addr)
+		cancel()
+		if err == nil {
+			return conn, nil
+		}
+
+		if shouldWake(dev.Name) {
+			log.Printf("Wake proxy: waking %s for a connection from %s", dev.Name, from)
+			if err := wake(dev); err != nil {
+				log.Printf("Wake proxy: failed to wake %s: %v", dev.Name, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(dialInterval):
+		}
+	}
+}
+
+// shouldWake reports whether a burst for name is due and records it.
+func shouldWake(name string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	if time.Since(lastWake[name]) < config.GetRetryInterval() {
+		return false
+	}
+	lastWake[name] = time.Now()
+	return true
+}
+
+// pipe copies src to dst and half-closes dst when src ends.
+func pipe(dst, src net.Conn, done chan<- struct{}) {
+	io.Copy(dst, src)
+	if tcp, ok := dst.(*net.TCPConn); ok {
+		tcp.CloseWrite()
+	} else {
+		dst.Close()
+	}
+	done <- struct{}{}
+}
+
+func findDevice(name string) (device.Computer, bool) {
+	for _, dev := range device.All() {
+		if dev.Name == name {
+			return dev, true
+		}
+	}
+	return device.Computer{}, false
+}
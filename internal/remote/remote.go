@@ -0,0 +1,140 @@
+// Package remote powers devices off, reboots or suspends them by running a
+// command over SSH.
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eblancof/telegram-bot/internal/config"
+	"github.com/eblancof/telegram-bot/internal/device"
+)
+
+const (
+	ActionShutdown = "shutdown"
+	ActionReboot   = "reboot"
+	ActionSleep    = "sleep"
+)
+
+// DefaultCommands are run when a device has no command of its own.
+var DefaultCommands = map[string]string{
+	ActionShutdown: "sudo systemctl poweroff",
+	ActionReboot:   "sudo systemctl reboot",
+	ActionSleep:    "sudo systemctl suspend",
+}
+
+// hostKeyAlias names the pinned host key in the temporary known_hosts file,
+// so it matches whatever address and port the device is reached on.
+const hostKeyAlias = "wol-bot-device"
+
+// runTimeout bounds a whole SSH session.
+const runTimeout = 30 * time.Second
+
+var (
+	ErrNoSSH         = errors.New("device has no SSH access configured")
+	ErrNoKey         = errors.New("SSH_KEY_FILE is not set")
+	ErrUnknownAction = errors.New("unknown power action")
+	ErrInvalidKey    = errors.New("invalid SSH host key")
+)
+
+// Command returns the command run on dev for action.
+func Command(dev device.Computer, action string) (string, error) {
+	var custom string
+	switch action {
+	case ActionShutdown:
+		custom = dev.ShutdownCommand
+	case ActionReboot:
+		custom = dev.RebootCommand
+	case ActionSleep:
+		custom = dev.SleepCommand
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownAction, action)
+	}
+	if custom != "" {
+		return custom, nil
+	}
+	return DefaultCommands[action], nil
+}
+
+// Run executes the command for action on dev over SSH and returns its
+// combined output. The host key must match dev.SSHHostKey.
+func Run(ctx context.Context, dev device.Computer, action string) (string, error) {
+	if !dev.HasSSH() {
+		return "", ErrNoSSH
+	}
+	keyFile := config.GetSSHKeyFile()
+	if keyFile == "" {
+		return "", ErrNoKey
+	}
+	command, err := Command(dev, action)
+	if err != nil {
+		return "", err
+	}
+
+	knownHosts, err := os.CreateTemp("", "wol-known-hosts-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(knownHosts.Name())
+	_, err = fmt.Fprintf(knownHosts, "%s %s\n", hostKeyAlias, dev.SSHHostKey)
+	if cerr := knownHosts.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, runTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "ssh",
+		"-i", keyFile,
+		"-p", strconv.Itoa(dev.SSHTargetPort()),
+		"-l", dev.SSHUser,
+		"-o", "BatchMode=yes",
+		"-o", "IdentitiesOnly=yes",
+		"-o", "StrictHostKeyChecking=yes",
+		"-o", "UserKnownHostsFile="+knownHosts.Name(),
+		"-o", "GlobalKnownHostsFile=/dev/null",
+		"-o", "HostKeyAlias="+hostKeyAlias,
+		"-o", "ConnectTimeout=10",
+		"--", dev.SSHTargetHost(), command)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err = cmd.Run()
+	output := strings.TrimSpace(out.String())
+
+	// A machine going down may drop the session before the command returns.
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 255 && action != ActionSleep &&
+		strings.Contains(output, "closed by remote host") {
+		return output, nil
+	}
+	return output, err
+}
+
+// ParseHostKey validates a host key in known_hosts form, such as
+// "ssh-ed25519 AAAAC3Nza…", and returns it without a trailing comment.
+func ParseHostKey(text string) (string, error) {
+	fields := strings.Fields(text)
+	if len(fields) < 2 {
+		return "", ErrInvalidKey
+	}
+	if !strings.HasPrefix(fields[0], "ssh-") && !strings.HasPrefix(fields[0], "ecdsa-") &&
+		!strings.HasPrefix(fields[0], "sk-") {
+		return "", fmt.Errorf("%w: unknown key type %q", ErrInvalidKey, fields[0])
+	}
+	if _, err := base64.StdEncoding.DecodeString(fields[1]); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	return fields[0] + " " + fields[1], nil
+}
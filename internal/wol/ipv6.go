@@ -0,0 +1,89 @@
+package wol
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/eblancof/telegram-bot/pkg/magicpacket"
+)
+
+// IPv6AllNodes is the link-local all-nodes multicast group.
+const IPv6AllNodes = "ff02::1"
+
+func ipv6Sender(target Target) (magicpacket.Sender, error) {
+	var local *net.UDPAddr
+	if target.Source != "" {
+		ip := net.ParseIP(target.Source)
+		if ip == nil || ip.To4() != nil {
+			return nil, fmt.Errorf("invalid IPv6 source address %q", target.Source)
+		}
+		local = &net.UDPAddr{IP: ip, Zone: target.Interface}
+	}
+
+	if target.Address != "" {
+		addr, err := netip.ParseAddr(target.Address)
+		if err != nil || !addr.Is6() || addr.Is4In6() {
+			return nil, fmt.Errorf("invalid IPv6 address %q", target.Address)
+		}
+		if addr.Zone() == "" && target.Interface != "" && (addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast()) {
+			addr = addr.WithZone(target.Interface)
+		}
+		return udp6Sender(addr, target.Port, local), nil
+	}
+
+	allNodes := netip.MustParseAddr(IPv6AllNodes)
+	if !target.AllInterfaces {
+		if target.Interface == "" {
+			return nil, ErrInterfaceRequired
+		}
+		return udp6Sender(allNodes.WithZone(target.Interface), target.Port, local), nil
+	}
+
+	names, err := ipv6Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, ErrNoInterfaces
+	}
+	var senders magicpacket.MultiSender
+	for _, name := range names {
+		senders = append(senders, udp6Sender(allNodes.WithZone(name), target.Port, nil))
+	}
+	return senders, nil
+}
+
+func udp6Sender(addr netip.Addr, port int, local *net.UDPAddr) *magicpacket.UDPSender {
+	return &magicpacket.UDPSender{
+		Addr:      net.UDPAddrFromAddrPort(netip.AddrPortFrom(addr, uint16(port))),
+		LocalAddr: local,
+	}
+}
+
+// ipv6Interfaces lists every up, non-loopback, multicast capable interface
+// that has an IPv6 address.
+func ipv6Interfaces() ([]string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() == nil {
+				names = append(names, iface.Name)
+				break
+			}
+		}
+	}
+	return names, nil
+}
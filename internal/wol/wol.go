@@ -1,32 +1,192 @@
 package wol
 
 import (
-	"encoding/hex"
+	"errors"
+	"fmt"
 	"net"
-	"strings"
+	"time"
+
+	"github.com/eblancof/telegram-bot/internal/config"
+	"github.com/eblancof/telegram-bot/internal/device"
+	"github.com/eblancof/telegram-bot/internal/netif"
+	"github.com/eblancof/telegram-bot/pkg/magicpacket"
+)
+
+const (
+	// TransportUDP sends the magic packet as a UDP datagram.
+	TransportUDP = "udp"
+	// TransportEthernet sends the magic packet as a raw layer-2 frame with
+	// EtherType 0x0842, like etherwake does.
+	TransportEthernet = "ethernet"
+	// TransportIPv6 sends the magic packet as a UDP datagram to an IPv6
+	// unicast address or to the link-local all-nodes multicast group.
+	TransportIPv6 = "ipv6"
+)
+
+var (
+	ErrInterfaceRequired    = errors.New("transport requires a network interface")
+	ErrUnsupportedTransport = errors.New("unsupported transport")
+	ErrNoInterfaces         = errors.New("no usable IPv4 interfaces")
 )
 
-func SendWakeOnLAN(macAddress, broadcastIP string, port int) error {
-	mac, err := hex.DecodeString(strings.Replace(macAddress, ":", "", -1))
+// Target describes where and how a magic packet is delivered.
+type Target struct {
+	// Transport is TransportUDP (the default when empty) or TransportEthernet.
+	Transport string
+	// Address and Port are the UDP destination. For TransportIPv6 an empty
+	// Address means ff02::1 on Interface.
+	Address string
+	Port    int
+	// Interface is the network interface packets are sent on. Source binds
+	// UDP packets to a local address instead.
+	Interface string
+	Source    string
+	// AllInterfaces sends the packet on every up IPv4 interface, using each
+	// interface's own broadcast address for UDP.
+	AllInterfaces bool
+	// Count is the number of packets sent in a burst (at least one) and
+	// Interval the pause between them.
+	Count    int
+	Interval time.Duration
+}
+
+// BurstSize returns how many packets a burst of count packets sent interval
+// apart really has, at least one and cut short to fit
+// config.MaxBurstDuration.
+func BurstSize(count int, interval time.Duration) int {
+	if count < 1 {
+		count = 1
+	}
+	for count > 1 && !config.BurstFits(count, interval) {
+		count--
+	}
+	return count
+}
+
+// SendWakeOnLAN sends a burst of BurstSize magic packets for mac to target
+// and returns how many of them were sent successfully and how many were
+// attempted. A non-empty password is appended to the packet as a SecureOn
+// password. The error is only nil when every packet of the burst was sent.
+func SendWakeOnLAN(mac device.MAC, password string, target Target) (sent, attempted int, err error) {
+	secureOn, err := magicpacket.ParsePassword(password)
+	if err != nil {
+		return 0, 0, err
+	}
+	packet, err := magicpacket.New(mac.HardwareAddr(), secureOn)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	sender, err := NewSender(target)
 	if err != nil {
-		return err
+		return 0, 0, err
 	}
 
-	var packet []byte
-	packet = append(packet, []byte{255, 255, 255, 255, 255, 255}...)
-	for i := 0; i < 16; i++ {
-		packet = append(packet, mac...)
+	count := BurstSize(target.Count, target.Interval)
+
+	var errs []error
+	for i := 0; i < count; i++ {
+		if i > 0 && target.Interval > 0 {
+			time.Sleep(target.Interval)
+		}
+		if err := sender.Send(packet); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		sent++
+	}
+	return sent, count, errors.Join(errs...)
+}
+
+// NewSender returns the magicpacket.Sender that delivers packets to target.
+func NewSender(target Target) (magicpacket.Sender, error) {
+	switch target.Transport {
+	case "", TransportUDP:
+		return udpSender(target)
+	case TransportEthernet:
+		if target.AllInterfaces {
+			seen := make(map[string]bool)
+			return eachInterface(func(addr netif.InterfaceAddr) magicpacket.Sender {
+				if seen[addr.Name] {
+					return nil
+				}
+				seen[addr.Name] = true
+				return &magicpacket.EthernetSender{Interface: addr.Name}
+			})
+		}
+		if target.Interface == "" {
+			return nil, ErrInterfaceRequired
+		}
+		return &magicpacket.EthernetSender{Interface: target.Interface}, nil
+	case TransportIPv6:
+		return ipv6Sender(target)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedTransport, target.Transport)
+	}
+}
+
+func udpSender(target Target) (magicpacket.Sender, error) {
+	if target.AllInterfaces {
+		return eachInterface(func(addr netif.InterfaceAddr) magicpacket.Sender {
+			return &magicpacket.UDPSender{
+				Addr:      &net.UDPAddr{IP: addr.Broadcast, Port: target.Port},
+				LocalAddr: &net.UDPAddr{IP: addr.IP},
+				Interface: addr.Name,
+			}
+		})
+	}
+
+	sender := &magicpacket.UDPSender{Interface: target.Interface}
+	dest := net.ParseIP(target.Address)
+	switch {
+	case target.Source != "":
+		local := net.ParseIP(target.Source)
+		if local == nil {
+			return nil, fmt.Errorf("invalid source address %q", target.Source)
+		}
+		sender.LocalAddr = &net.UDPAddr{IP: local}
+	case target.Interface != "":
+		addr, err := netif.ByName(target.Interface)
+		if err != nil {
+			return nil, err
+		}
+		sender.LocalAddr = &net.UDPAddr{IP: addr.IP}
+		if target.Address == "" {
+			dest = addr.Broadcast
+		}
+	}
+	if dest == nil {
+		return nil, fmt.Errorf("invalid target address %q", target.Address)
 	}
+	sender.Addr = &net.UDPAddr{IP: dest, Port: target.Port}
+	return sender, nil
+}
 
-	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{
-		IP:   net.ParseIP(broadcastIP),
-		Port: port,
-	})
+// eachInterface builds a sender for every up IPv4 interface address,
+// skipping addresses for which newSender returns nil.
+func eachInterface(newSender func(netif.InterfaceAddr) magicpacket.Sender) (magicpacket.Sender, error) {
+	addrs, err := netif.InterfaceAddrs()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, ErrNoInterfaces
 	}
-	defer conn.Close()
 
-	_, err = conn.Write(packet)
-	return err
+	var senders magicpacket.MultiSender
+	for _, addr := range addrs {
+		if sender := newSender(addr); sender != nil {
+			senders = append(senders, sender)
+		}
+	}
+	return senders, nil
+}
+
+// FormatSecureOn returns the canonical colon separated form of password.
+func FormatSecureOn(password string) (string, error) {
+	b, err := magicpacket.ParsePassword(password)
+	if err != nil || b == nil {
+		return "", err
+	}
+	return net.HardwareAddr(b).String(), nil
 }
@@ -0,0 +1,36 @@
+package magicpacket
+
+import (
+	"errors"
+	"net"
+)
+
+// EtherType is the EtherType registered for Wake-on-LAN frames.
+const EtherType = 0x0842
+
+// ErrRawUnsupported is returned by EthernetSender outside linux.
+var ErrRawUnsupported = errors.New("raw ethernet frames are only supported on linux")
+
+// BroadcastMAC is the default destination of raw ethernet frames.
+var BroadcastMAC = net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+// EthernetSender sends magic packets as the payload of EtherType 0x0842
+// frames on Interface, like etherwake does. It needs CAP_NET_RAW.
+type EthernetSender struct {
+	Interface string
+	// Destination defaults to BroadcastMAC.
+	Destination net.HardwareAddr
+}
+
+func (s *EthernetSender) Send(p *MagicPacket) error {
+	b, err := p.Marshal()
+	if err != nil {
+		return err
+	}
+
+	dst := s.Destination
+	if dst == nil {
+		dst = BroadcastMAC
+	}
+	return sendEthernet(b, s.Interface, dst)
+}
@@ -0,0 +1,40 @@
+//go:build linux
+
+package magicpacket
+
+import (
+	"net"
+	"syscall"
+)
+
+func sendEthernet(packet []byte, ifaceName string, dst net.HardwareAddr) error {
+	iface, err := net.InterfaceByName(ifaceName)
+	if err != nil {
+		return err
+	}
+
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(htons(EtherType)))
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	frame := make([]byte, 0, 14+len(packet))
+	frame = append(frame, dst...)
+	frame = append(frame, iface.HardwareAddr...)
+	frame = append(frame, byte(EtherType>>8), byte(EtherType&0xff))
+	frame = append(frame, packet...)
+
+	addr := &syscall.SockaddrLinklayer{
+		Protocol: htons(EtherType),
+		Ifindex:  iface.Index,
+		Halen:    uint8(len(dst)),
+	}
+	copy(addr.Addr[:], dst)
+
+	return syscall.Sendto(fd, frame, 0, addr)
+}
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
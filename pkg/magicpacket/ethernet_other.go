@@ -0,0 +1,9 @@
+//go:build !linux
+
+package magicpacket
+
+import "net"
+
+func sendEthernet(packet []byte, ifaceName string, dst net.HardwareAddr) error {
+	return ErrRawUnsupported
+}
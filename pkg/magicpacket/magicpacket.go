@@ -0,0 +1,120 @@
+// Package magicpacket builds, parses and sends Wake-on-LAN magic packets.
+//
+// A magic packet is six 0xFF bytes followed by sixteen repetitions of the
+// target's MAC address, optionally followed by a 4 or 6 byte SecureOn
+// password.
+package magicpacket
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	// Size is the length of a magic packet without a password.
+	Size = syncLen + repetitions*macLen
+
+	syncLen     = 6
+	macLen      = 6
+	repetitions = 16
+)
+
+var (
+	ErrInvalidMAC      = errors.New("magic packet MAC must be 6 bytes")
+	ErrInvalidPassword = errors.New("SecureOn password must be 4 or 6 bytes")
+	ErrInvalidPacket   = errors.New("not a magic packet")
+)
+
+var syncStream = bytes.Repeat([]byte{0xff}, syncLen)
+
+// MagicPacket wakes the NIC with the hardware address MAC. Password is an
+// optional SecureOn password.
+type MagicPacket struct {
+	MAC      net.HardwareAddr
+	Password []byte
+}
+
+// New returns a validated magic packet for mac and password.
+func New(mac net.HardwareAddr, password []byte) (*MagicPacket, error) {
+	p := &MagicPacket{MAC: mac, Password: password}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Validate checks the MAC and password lengths.
+func (p *MagicPacket) Validate() error {
+	if len(p.MAC) != macLen {
+		return ErrInvalidMAC
+	}
+	if n := len(p.Password); n != 0 && n != 4 && n != 6 {
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
+// Marshal returns the wire form of p.
+func (p *MagicPacket) Marshal() ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 0, Size+len(p.Password))
+	b = append(b, syncStream...)
+	for i := 0; i < repetitions; i++ {
+		b = append(b, p.MAC...)
+	}
+	return append(b, p.Password...), nil
+}
+
+// Unmarshal parses the wire form of a magic packet into p.
+func (p *MagicPacket) Unmarshal(b []byte) error {
+	if len(b) < Size || !bytes.Equal(b[:syncLen], syncStream) {
+		return ErrInvalidPacket
+	}
+
+	mac := b[syncLen : syncLen+macLen]
+	for i := 1; i < repetitions; i++ {
+		offset := syncLen + i*macLen
+		if !bytes.Equal(b[offset:offset+macLen], mac) {
+			return fmt.Errorf("%w: MAC repetition %d differs", ErrInvalidPacket, i+1)
+		}
+	}
+
+	password := b[Size:]
+	if n := len(password); n != 0 && n != 4 && n != 6 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrInvalidPacket, n)
+	}
+
+	p.MAC = append(net.HardwareAddr(nil), mac...)
+	p.Password = nil
+	if len(password) > 0 {
+		p.Password = append([]byte(nil), password...)
+	}
+	return nil
+}
+
+// ParsePassword parses a SecureOn password written either as 4 or 6 hex
+// bytes (separated by ':' or '-', or not at all) or as a dotted IPv4-style
+// quad. An empty string yields a nil password.
+func ParsePassword(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	if ip := net.ParseIP(s); ip != nil && ip.To4() != nil && strings.Count(s, ".") == 3 {
+		return []byte(ip.To4()), nil
+	}
+
+	b, err := hex.DecodeString(strings.NewReplacer(":", "", "-", "").Replace(s))
+	if err != nil || (len(b) != 4 && len(b) != 6) {
+		return nil, ErrInvalidPassword
+	}
+	return b, nil
+}
@@ -0,0 +1,195 @@
+package magicpacket
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+)
+
+var testMAC = net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+
+// wire builds a magic packet for mac by hand, followed by extra.
+func wire(mac net.HardwareAddr, extra ...byte) []byte {
+	b := bytes.Repeat([]byte{0xff}, 6)
+	for i := 0; i < 16; i++ {
+		b = append(b, mac...)
+	}
+	return append(b, extra...)
+}
+
+func TestMarshalUnmarshalRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		password []byte
+	}{
+		{"no password", nil},
+		{"4-byte password", []byte{192, 168, 1, 1}},
+		{"6-byte password", []byte{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := New(testMAC, tt.password)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			b, err := p.Marshal()
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if want := wire(testMAC, tt.password...); !bytes.Equal(b, want) {
+				t.Fatalf("Marshal = %x, want %x", b, want)
+			}
+			if len(b) != Size+len(tt.password) {
+				t.Errorf("len = %d, want %d", len(b), Size+len(tt.password))
+			}
+
+			var got MagicPacket
+			if err := got.Unmarshal(b); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if !bytes.Equal(got.MAC, testMAC) {
+				t.Errorf("MAC = %s, want %s", got.MAC, testMAC)
+			}
+			if !bytes.Equal(got.Password, tt.password) {
+				t.Errorf("Password = %x, want %x", got.Password, tt.password)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		mac      net.HardwareAddr
+		password []byte
+		want     error
+	}{
+		{"valid", testMAC, nil, nil},
+		{"short MAC", testMAC[:5], nil, ErrInvalidMAC},
+		{"EUI-64", append(testMAC, 0x66, 0x77), nil, ErrInvalidMAC},
+		{"5-byte password", testMAC, []byte{1, 2, 3, 4, 5}, ErrInvalidPassword},
+		{"8-byte password", testMAC, make([]byte, 8), ErrInvalidPassword},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &MagicPacket{MAC: tt.mac, Password: tt.password}
+			if err := p.Validate(); err != tt.want {
+				t.Errorf("Validate = %v, want %v", err, tt.want)
+			}
+			if _, err := p.Marshal(); err != tt.want {
+				t.Errorf("Marshal error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	badSync := wire(testMAC)
+	badSync[3] = 0xfe
+
+	badRepetition := wire(testMAC)
+	badRepetition[6+7*6] ^= 0x01
+
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{"empty", nil},
+		{"truncated", wire(testMAC)[:Size-1]},
+		{"bad sync stream", badSync},
+		{"wrong repetition", badRepetition},
+		{"1 trailing byte", wire(testMAC, 0x01)},
+		{"5 trailing bytes", wire(testMAC, 1, 2, 3, 4, 5)},
+		{"7 trailing bytes", wire(testMAC, 1, 2, 3, 4, 5, 6, 7)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := MagicPacket{MAC: testMAC}
+			err := p.Unmarshal(tt.b)
+			if !errors.Is(err, ErrInvalidPacket) {
+				t.Fatalf("Unmarshal = %v, want %v", err, ErrInvalidPacket)
+			}
+			if !bytes.Equal(p.MAC, testMAC) {
+				t.Errorf("Unmarshal modified p on error: MAC = %s", p.MAC)
+			}
+		})
+	}
+}
+
+func TestParsePassword(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []byte
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"  ", nil, false},
+		{"aa:bb:cc:dd", []byte{0xaa, 0xbb, 0xcc, 0xdd}, false},
+		{"AA-BB-CC-DD-EE-FF", []byte{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}, false},
+		{"aabbccddeeff", []byte{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}, false},
+		{"192.168.1.1", []byte{192, 168, 1, 1}, false},
+		{"aa:bb:cc", nil, true},
+		{"aa:bb:cc:dd:ee", nil, true},
+		{"aa:bb:cc:dd:ee:ff:00", nil, true},
+		{"zz:bb:cc:dd", nil, true},
+		{"::1", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParsePassword(tt.in)
+			if tt.wantErr {
+				if err != ErrInvalidPassword {
+					t.Fatalf("ParsePassword(%q) error = %v, want %v", tt.in, err, ErrInvalidPassword)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePassword(%q): %v", tt.in, err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("ParsePassword(%q) = %x, want %x", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeSender counts the packets it is asked to send and fails with err.
+type fakeSender struct {
+	err  error
+	sent int
+}
+
+func (s *fakeSender) Send(p *MagicPacket) error {
+	s.sent++
+	return s.err
+}
+
+func TestMultiSender(t *testing.T) {
+	errDown := errors.New("interface down")
+	errNoRoute := errors.New("no route")
+	p, _ := New(testMAC, nil)
+
+	t.Run("partial failure", func(t *testing.T) {
+		failing, working := &fakeSender{err: errDown}, &fakeSender{}
+		if err := (MultiSender{failing, working}).Send(p); err != nil {
+			t.Fatalf("Send = %v, want nil", err)
+		}
+		if failing.sent != 1 || working.sent != 1 {
+			t.Errorf("sent = %d, %d, want every sender tried once", failing.sent, working.sent)
+		}
+	})
+
+	t.Run("all fail", func(t *testing.T) {
+		err := (MultiSender{&fakeSender{err: errDown}, &fakeSender{err: errNoRoute}}).Send(p)
+		if !errors.Is(err, errDown) || !errors.Is(err, errNoRoute) {
+			t.Fatalf("Send = %v, want both errors", err)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		if err := (MultiSender{}).Send(p); err == nil {
+			t.Fatal("Send with no senders succeeded")
+		}
+	})
+}
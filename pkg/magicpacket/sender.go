@@ -0,0 +1,74 @@
+package magicpacket
+
+import (
+	"errors"
+	"net"
+)
+
+// Sender delivers magic packets.
+type Sender interface {
+	Send(p *MagicPacket) error
+}
+
+// UDPSender sends magic packets as UDP datagrams to Addr. Both IPv4
+// broadcast/unicast and IPv6 unicast/multicast destinations are supported;
+// link-local IPv6 destinations need Addr.Zone set.
+type UDPSender struct {
+	Addr *net.UDPAddr
+	// LocalAddr optionally binds the source address.
+	LocalAddr *net.UDPAddr
+	// Interface optionally pins the socket to a network interface. It is
+	// only honoured on linux and needs CAP_NET_RAW on older kernels; without
+	// it the socket stays bound to LocalAddr only.
+	Interface string
+}
+
+// NewUDPSender returns a sender for a "host:port" destination.
+func NewUDPSender(address string) (*UDPSender, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &UDPSender{Addr: addr}, nil
+}
+
+func (s *UDPSender) Send(p *MagicPacket) error {
+	b, err := p.Marshal()
+	if err != nil {
+		return err
+	}
+
+	dialer := net.Dialer{Control: bindToDevice(s.Interface)}
+	if s.LocalAddr != nil {
+		dialer.LocalAddr = s.LocalAddr
+	}
+
+	conn, err := dialer.Dial("udp", s.Addr.String())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write(b)
+	return err
+}
+
+// MultiSender sends every packet through all of its senders. It only fails
+// when none of them succeeded.
+type MultiSender []Sender
+
+func (m MultiSender) Send(p *MagicPacket) error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Send(p); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(m) > 0 && len(errs) < len(m) {
+		return nil
+	}
+	if len(errs) == 0 {
+		return errors.New("no senders")
+	}
+	return errors.Join(errs...)
+}
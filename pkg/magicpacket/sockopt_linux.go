@@ -0,0 +1,30 @@
+//go:build linux
+
+package magicpacket
+
+import (
+	"errors"
+	"syscall"
+)
+
+// bindToDevice pins a socket to ifaceName with SO_BINDTODEVICE so packets
+// leave through that interface regardless of the routing table. Without the
+// required privileges the socket stays bound to the interface's address only.
+func bindToDevice(ifaceName string) func(network, address string, c syscall.RawConn) error {
+	if ifaceName == "" {
+		return nil
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			sockErr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, ifaceName)
+		})
+		if err != nil {
+			return err
+		}
+		if errors.Is(sockErr, syscall.EPERM) {
+			return nil
+		}
+		return sockErr
+	}
+}
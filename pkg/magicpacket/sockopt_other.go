@@ -0,0 +1,11 @@
+//go:build !linux
+
+package magicpacket
+
+import "syscall"
+
+// bindToDevice is a no-op outside linux; sockets are bound to the
+// interface's address instead.
+func bindToDevice(ifaceName string) func(network, address string, c syscall.RawConn) error {
+	return nil
+}